@@ -0,0 +1,180 @@
+// Package auth verifies the JWTs issued by SignIn and makes the signed-in user available to handlers.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/config"
+	"mySplitBackEnd/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// contextKey keeps the values this package stores in a request context private to it.
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	sessionIDKey
+)
+
+// Tokens signs and verifies access tokens and issues the refresh tokens of sessions.
+//
+// When signing keys are configured, tokens are signed with the first of them and carry its
+// ID in the "kid" header; HS256 tokens signed with the secret are only accepted until the
+// end of the legacy window. Without signing keys every token is HS256.
+type Tokens struct {
+	secret      []byte
+	otpKey      []byte
+	keys        *KeySet
+	legacyUntil time.Time
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+}
+
+// NewTokens returns Tokens using the secret, signing keys and lifetimes configured in cfg.
+func NewTokens(cfg config.Config) (*Tokens, error) {
+	keys, err := LoadKeySet(cfg.SigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		secret:      []byte(cfg.JWTSecret),
+		otpKey:      []byte(cfg.OTPSecret),
+		keys:        keys,
+		legacyUntil: cfg.LegacyHS256Until,
+		accessTTL:   time.Duration(cfg.AccessTokenTTL),
+		refreshTTL:  time.Duration(cfg.RefreshTokenTTL),
+	}, nil
+}
+
+// JWKS returns the public keys tokens can be verified with.
+func (t *Tokens) JWKS() []JWK {
+	return t.keys.JWKS()
+}
+
+// IssueAccessToken signs a short-lived access token for a user's session family.
+func (t *Tokens) IssueAccessToken(userID, sessionID primitive.ObjectID) (string, time.Time, error) {
+	expirationTime := time.Now().Add(t.accessTTL)
+	claims := &models.Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expirationTime.Unix(),
+		},
+	}
+
+	if t.keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		tokenString, err := token.SignedString(t.secret)
+		return tokenString, expirationTime, err
+	}
+
+	signing := t.keys.signing
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	tokenString, err := token.SignedString(signing.private)
+	return tokenString, expirationTime, err
+}
+
+// ParseToken verifies a signed token and returns its claims.
+func (t *Tokens) ParseToken(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, t.verificationKey)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if claims.UserID == primitive.NilObjectID {
+		return nil, errors.New("token has no user")
+	}
+	if claims.SessionID == primitive.NilObjectID {
+		return nil, errors.New("token has no session")
+	}
+	return claims, nil
+}
+
+// verificationKey picks the key a token must have been signed with, based on its
+// algorithm and key ID.
+func (t *Tokens) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		if t.keys != nil && !time.Now().Before(t.legacyUntil) {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		return t.secret, nil
+	}
+	if t.keys == nil {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, ok := t.keys.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method != k.method {
+		return nil, fmt.Errorf("key %q does not sign with %v", kid, token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+// Middleware returns a middleware that rejects requests without a valid
+// "Authorization: Bearer <token>" header or whose session was revoked, and stores the
+// user and session IDs from the token in the request context.
+func (t *Tokens) Middleware(sessions *mongo.Collection) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			tokenString := strings.TrimPrefix(header, "Bearer ")
+			if header == "" || tokenString == header {
+				unauthorized(w, "Missing bearer token")
+				return
+			}
+
+			claims, err := t.ParseToken(tokenString)
+			if err != nil {
+				unauthorized(w, "Invalid token")
+				return
+			}
+
+			active, err := IsActive(r.Context(), sessions, claims.SessionID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !active {
+				unauthorized(w, "Session has been signed out")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserID returns the ID of the signed-in user stored in the context by Middleware.
+func UserID(ctx context.Context) (primitive.ObjectID, bool) {
+	userID, ok := ctx.Value(userIDKey).(primitive.ObjectID)
+	return userID, ok
+}
+
+// SessionID returns the session family ID stored in the context by Middleware.
+func SessionID(ctx context.Context) (primitive.ObjectID, bool) {
+	sessionID, ok := ctx.Value(sessionIDKey).(primitive.ObjectID)
+	return sessionID, ok
+}
+
+// unauthorized responds with 401 and asks the client for a bearer token.
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="mySplit"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// expiresIndex removes documents once their expiresAt has passed.
+var expiresIndex = mongo.IndexModel{
+	Keys:    bson.M{"expiresAt": 1},
+	Options: options.Index().SetExpireAfterSeconds(0),
+}
+
+// CreateIndexes makes sure the collections auth reads on every request or sign-in have the
+// indexes those lookups need, and TTL indexes that remove sessions, tokens and codes once
+// they have expired.
+func CreateIndexes(ctx context.Context, sessions, userTokens, otps, invitations *mongo.Collection) error {
+	if _, err := sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"tokenHash": 1}},
+		{Keys: bson.D{{Key: "familyId", Value: 1}, {Key: "revoked", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "revoked", Value: 1}}},
+		expiresIndex,
+	}); err != nil {
+		return err
+	}
+	if _, err := userTokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"tokenHash": 1}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "purpose", Value: 1}}},
+		expiresIndex,
+	}); err != nil {
+		return err
+	}
+	if _, err := otps.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "mobileNumber", Value: 1}, {Key: "createdAt", Value: -1}}},
+		// Codes are kept for an hour, not until they expire, as IssueOTP counts them
+		{Keys: bson.M{"createdAt": 1}, Options: options.Index().SetExpireAfterSeconds(int32(time.Hour.Seconds()))},
+	}); err != nil {
+		return err
+	}
+	_, err := invitations.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.M{"tokenHash": 1}})
+	return err
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+// ErrInvalidInvitation is returned for invitation tokens that are unknown, expired or
+// already accepted.
+var ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+// IssueInvitation stores an invitation and returns the token for its link.
+func IssueInvitation(ctx context.Context, invitations *mongo.Collection, invitation models.Invitation) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	invitation.TokenHash = hashToken(token)
+	if _, err := invitations.InsertOne(ctx, invitation); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// AcceptInvitation marks the invitation with the token as accepted by a user and returns
+// it. An invitation can only be accepted once.
+func AcceptInvitation(ctx context.Context, invitations *mongo.Collection, token string, user models.User) (models.Invitation, error) {
+	now := time.Now()
+	var invitation models.Invitation
+	err := invitations.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash":  hashToken(token),
+			"acceptedAt": bson.M{"$exists": false},
+			"expiresAt":  bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"acceptedAt": now, "acceptedBy": user.ID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&invitation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return invitation, ErrInvalidInvitation
+	}
+	return invitation, err
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"mySplitBackEnd/config"
+	"os"
+)
+
+// SigningMethodEdDSA signs tokens with Ed25519, which jwt-go does not provide itself.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("EdDSA verification failed")
+	}
+	return nil
+}
+
+// key is an asymmetric key loaded from a PEM file.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer // nil for keys that only verify
+	public  crypto.PublicKey
+}
+
+// KeySet holds the asymmetric keys tokens are signed and verified with.
+type KeySet struct {
+	signing *key
+	keys    map[string]*key
+	order   []string // Key IDs in configuration order, for a stable JWKS
+}
+
+// LoadKeySet reads the configured key files. The first key signs new tokens and must be a
+// private key; every key verifies tokens carrying its ID. It returns nil when no keys are configured.
+func LoadKeySet(signingKeys []config.SigningKey) (*KeySet, error) {
+	if len(signingKeys) == 0 {
+		return nil, nil
+	}
+	set := &KeySet{keys: make(map[string]*key)}
+	for _, sk := range signingKeys {
+		k, err := loadKey(sk)
+		if err != nil {
+			return nil, err
+		}
+		set.keys[k.id] = k
+		set.order = append(set.order, k.id)
+	}
+	set.signing = set.keys[signingKeys[0].ID]
+	if set.signing.private == nil {
+		return nil, fmt.Errorf("signing key %q must be a private key", set.signing.id)
+	}
+	return set, nil
+}
+
+// loadKey parses a PEM file holding an RSA or Ed25519 key.
+func loadKey(sk config.SigningKey) (*key, error) {
+	data, err := os.ReadFile(sk.File)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %q: %s is not a PEM file", sk.ID, sk.File)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", sk.ID, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", sk.ID, err)
+	}
+
+	k := &key{id: sk.ID}
+	switch typed := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method, k.private, k.public = jwt.SigningMethodRS256, typed, &typed.PublicKey
+	case *rsa.PublicKey:
+		k.method, k.public = jwt.SigningMethodRS256, typed
+	case ed25519.PrivateKey:
+		k.method, k.private, k.public = SigningMethodEdDSA, typed, typed.Public()
+	case ed25519.PublicKey:
+		k.method, k.public = SigningMethodEdDSA, typed
+	default:
+		return nil, fmt.Errorf("key %q: only RSA and Ed25519 keys are supported", sk.ID)
+	}
+	return k, nil
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // Curve of an OKP key
+	X   string `json:"x,omitempty"`   // Ed25519 public key
+}
+
+// JWKS returns the public half of every key, so other services can verify tokens.
+func (s *KeySet) JWKS() []JWK {
+	jwks := []JWK{}
+	if s == nil {
+		return jwks
+	}
+	for _, id := range s.order {
+		k := s.keys[id]
+		jwk := JWK{Kid: k.id, Alg: k.method.Alg(), Use: "sig"}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+const (
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+)
+
+// LockedFor returns how much longer a user's account stays locked, or 0 when it is not locked.
+func LockedFor(user models.User) time.Duration {
+	if remaining := time.Until(user.LockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// RecordFailedLogin counts a wrong password for a user, and locks the account for 15
+// minutes after five in a row. It returns how long the account is now locked for.
+func RecordFailedLogin(ctx context.Context, users *mongo.Collection, userID primitive.ObjectID) (time.Duration, error) {
+	var user models.User
+	err := users.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"failedLogins": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return 0, err
+	}
+	if user.FailedLogins < maxFailedLogins {
+		return 0, nil
+	}
+
+	// The count starts over, so the next five attempts after the lockout are allowed again
+	_, err = users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"failedLogins": 0, "lockedUntil": time.Now().Add(lockoutDuration)}})
+	return lockoutDuration, err
+}
+
+// ResetFailedLogins clears a user's count of wrong passwords and any lock on the account.
+func ResetFailedLogins(ctx context.Context, users *mongo.Collection, userID primitive.ObjectID) error {
+	_, err := users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"failedLogins": 0}, "$unset": bson.M{"lockedUntil": ""}})
+	return err
+}
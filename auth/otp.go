@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math/big"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+const (
+	otpDigits         = 6
+	otpTTL            = 5 * time.Minute
+	otpResendInterval = time.Minute
+	otpMaxPerHour     = 5
+	otpMaxAttempts    = 5
+)
+
+var (
+	// ErrOTPRateLimited is returned when codes are requested for a number too often.
+	ErrOTPRateLimited = errors.New("too many codes requested, try again later")
+	// ErrInvalidOTP is returned for codes that are wrong, expired or already used.
+	ErrInvalidOTP = errors.New("invalid or expired code")
+	// ErrOTPAttemptsExceeded is returned once a code has been guessed at too many times.
+	ErrOTPAttemptsExceeded = errors.New("too many attempts, request a new code")
+)
+
+// IssueOTP creates a sign-in code for a mobile number and returns it. userID is the user
+// the number belongs to, or the nil ID when it belongs to no one. Codes issued earlier for
+// the number stop working. At most one code a minute and five an hour are issued per number.
+func (t *Tokens) IssueOTP(ctx context.Context, otps *mongo.Collection, mobileNumber string, userID primitive.ObjectID) (string, error) {
+	now := time.Now()
+	var latest models.OTP
+	err := otps.FindOne(ctx, bson.M{"mobileNumber": mobileNumber},
+		options.FindOne().SetSort(bson.M{"createdAt": -1})).Decode(&latest)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+	if err == nil && now.Sub(latest.CreatedAt) < otpResendInterval {
+		return "", ErrOTPRateLimited
+	}
+	recent, err := otps.CountDocuments(ctx, bson.M{
+		"mobileNumber": mobileNumber,
+		"createdAt":    bson.M{"$gt": now.Add(-time.Hour)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if recent >= otpMaxPerHour {
+		return "", ErrOTPRateLimited
+	}
+
+	code, err := newOTPCode()
+	if err != nil {
+		return "", err
+	}
+	_, err = otps.UpdateMany(ctx,
+		bson.M{"mobileNumber": mobileNumber, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}})
+	if err != nil {
+		return "", err
+	}
+
+	otp := models.OTP{
+		ID:           primitive.NewObjectID(),
+		MobileNumber: mobileNumber,
+		UserID:       userID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(otpTTL),
+	}
+	otp.CodeHash = hashOTP(t.otpKey, otp.ID, code)
+	if _, err := otps.InsertOne(ctx, otp); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// VerifyOTP checks a code against the latest one issued for a mobile number and marks it as
+// used when it matches. Every check counts as an attempt, and a code stops working after
+// five of them.
+func (t *Tokens) VerifyOTP(ctx context.Context, otps *mongo.Collection, mobileNumber, code string) (models.OTP, error) {
+	now := time.Now()
+	var otp models.OTP
+	err := otps.FindOne(ctx,
+		bson.M{
+			"mobileNumber": mobileNumber,
+			"usedAt":       bson.M{"$exists": false},
+			"expiresAt":    bson.M{"$gt": now},
+		},
+		options.FindOne().SetSort(bson.M{"createdAt": -1}),
+	).Decode(&otp)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return otp, ErrInvalidOTP
+	}
+	if err != nil {
+		return otp, err
+	}
+
+	// Count the attempt before checking the code, so concurrent guesses cannot exceed the limit
+	result, err := otps.UpdateOne(ctx,
+		bson.M{"_id": otp.ID, "attempts": bson.M{"$lt": otpMaxAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}})
+	if err != nil {
+		return otp, err
+	}
+	if result.MatchedCount == 0 {
+		return otp, ErrOTPAttemptsExceeded
+	}
+	if subtle.ConstantTimeCompare([]byte(hashOTP(t.otpKey, otp.ID, code)), []byte(otp.CodeHash)) != 1 {
+		return otp, ErrInvalidOTP
+	}
+
+	result, err = otps.UpdateOne(ctx,
+		bson.M{"_id": otp.ID, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}})
+	if err != nil {
+		return otp, err
+	}
+	if result.ModifiedCount == 0 || otp.UserID == primitive.NilObjectID {
+		return otp, ErrInvalidOTP
+	}
+	otp.UsedAt = now
+	return otp, nil
+}
+
+// newOTPCode returns a random numeric code.
+func newOTPCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n), nil
+}
+
+// hashOTP returns the form a code is stored in: an HMAC of the code and the ID of its OTP,
+// so that a copy of the database is not enough to work out the codes.
+func hashOTP(key []byte, id primitive.ObjectID, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id.Hex() + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for refresh tokens that are unknown, expired or revoked.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when a refresh token that was already rotated is presented
+	// again. The whole session family is revoked, as the token has most likely been stolen.
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// StartSession creates a new session family for a user who just signed in and returns its refresh token.
+func (t *Tokens) StartSession(ctx context.Context, sessions *mongo.Collection, userID primitive.ObjectID, userAgent string) (string, models.Session, error) {
+	id := primitive.NewObjectID()
+	return t.insertSession(ctx, sessions, models.Session{
+		ID:        id,
+		UserID:    userID,
+		FamilyID:  id,
+		UserAgent: userAgent,
+	})
+}
+
+// RotateSession exchanges a refresh token for a new one in the same session family.
+func (t *Tokens) RotateSession(ctx context.Context, sessions *mongo.Collection, refreshToken string) (string, models.Session, error) {
+	var current models.Session
+	err := sessions.FindOne(ctx, bson.M{"tokenHash": hashToken(refreshToken)}).Decode(&current)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", current, ErrInvalidRefreshToken
+		}
+		return "", current, err
+	}
+	if current.Revoked || time.Now().After(current.ExpiresAt) {
+		return "", current, ErrInvalidRefreshToken
+	}
+	if current.ReplacedBy != primitive.NilObjectID {
+		return "", current, reuseDetected(ctx, sessions, current)
+	}
+
+	next := models.Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    current.UserID,
+		FamilyID:  current.FamilyID,
+		UserAgent: current.UserAgent,
+	}
+
+	// Only one caller can rotate a token; losing the race means the token was used twice
+	result, err := sessions.UpdateOne(ctx,
+		bson.M{"_id": current.ID, "revoked": false, "replacedBy": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"replacedBy": next.ID}})
+	if err != nil {
+		return "", current, err
+	}
+	if result.ModifiedCount == 0 {
+		return "", current, reuseDetected(ctx, sessions, current)
+	}
+	return t.insertSession(ctx, sessions, next)
+}
+
+// RevokeFamily signs out the device holding any session of the family.
+func RevokeFamily(ctx context.Context, sessions *mongo.Collection, familyID primitive.ObjectID) error {
+	return revoke(ctx, sessions, bson.M{"familyId": familyID})
+}
+
+// RevokeAll signs the user out on every device.
+func RevokeAll(ctx context.Context, sessions *mongo.Collection, userID primitive.ObjectID) error {
+	return revoke(ctx, sessions, bson.M{"userId": userID})
+}
+
+// IsActive reports whether a session family has not been revoked and has a session that has
+// not expired. Expired sessions are only removed by the TTL index some time later.
+func IsActive(ctx context.Context, sessions *mongo.Collection, familyID primitive.ObjectID) (bool, error) {
+	count, err := sessions.CountDocuments(ctx, bson.M{"familyId": familyID, "revoked": false, "expiresAt": bson.M{"$gt": time.Now()}})
+	return count > 0, err
+}
+
+// insertSession stores a session with a fresh refresh token and returns the token.
+func (t *Tokens) insertSession(ctx context.Context, sessions *mongo.Collection, session models.Session) (string, models.Session, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", session, err
+	}
+	session.TokenHash = hashToken(token)
+	session.CreatedAt = time.Now()
+	session.ExpiresAt = session.CreatedAt.Add(t.refreshTTL)
+	if _, err := sessions.InsertOne(ctx, session); err != nil {
+		return "", session, err
+	}
+	return token, session, nil
+}
+
+// reuseDetected revokes the family of a session whose token was presented after being rotated.
+func reuseDetected(ctx context.Context, sessions *mongo.Collection, session models.Session) error {
+	if err := RevokeFamily(ctx, sessions, session.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func revoke(ctx context.Context, sessions *mongo.Collection, filter bson.M) error {
+	filter["revoked"] = false
+	_, err := sessions.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked": true, "revokedAt": time.Now()}})
+	return err
+}
+
+// newToken returns a random, URL-safe token.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the form a refresh token is stored and looked up in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
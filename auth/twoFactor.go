@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/totp"
+	"strings"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes are issued when two-factor authentication is enabled.
+const recoveryCodeCount = 10
+
+// ErrInvalidSecondFactor is returned for authenticator codes and recovery codes that are
+// wrong or were already used.
+var ErrInvalidSecondFactor = errors.New("invalid authentication code")
+
+// NewRecoveryCodes returns new one-time recovery codes, and the bcrypt hashes to store.
+func NewRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+		hash, err := bcrypt.GenerateFromPassword([]byte(normalizeRecoveryCode(codes[i])), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes[i] = string(hash)
+	}
+	return codes, hashes, nil
+}
+
+// VerifySecondFactor checks an authenticator code, or failing that a recovery code, of a
+// user with two-factor authentication enabled. A code from the authenticator is refused
+// if it, or a later one, was already accepted, and a recovery code stops working once used.
+func VerifySecondFactor(ctx context.Context, users *mongo.Collection, user models.User, code, recoveryCode string) error {
+	if !user.TOTPEnabled {
+		return ErrInvalidSecondFactor
+	}
+
+	if code != "" {
+		counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidSecondFactor
+		}
+		result, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "totpLastCounter": bson.M{"$not": bson.M{"$gte": counter}}},
+			bson.M{"$set": bson.M{"totpLastCounter": counter}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+
+	normalized := normalizeRecoveryCode(recoveryCode)
+	if normalized == "" {
+		return ErrInvalidSecondFactor
+	}
+	for _, hash := range user.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(normalized)) != nil {
+			continue
+		}
+		// Pulling the hash only succeeds once, even when the code is used twice at the same time
+		result, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "recoveryCodes": hash},
+			bson.M{"$pull": bson.M{"recoveryCodes": hash}})
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+	return ErrInvalidSecondFactor
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes the user may type differently.
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+// ErrInvalidUserToken is returned for user tokens that are unknown, expired, already used
+// or issued for another purpose.
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// IssueUserToken creates a single-use token for a user and returns it. Tokens issued
+// earlier for the same purpose stop working, so only the latest email sent is valid.
+func IssueUserToken(ctx context.Context, userTokens *mongo.Collection, user models.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = userTokens.UpdateMany(ctx,
+		bson.M{"userId": user.ID, "purpose": purpose, "usedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"usedAt": now}})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = userTokens.InsertOne(ctx, models.UserToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks a token as used and returns it. A token can only be consumed once.
+func ConsumeUserToken(ctx context.Context, userTokens *mongo.Collection, token, purpose string) (models.UserToken, error) {
+	now := time.Now()
+	var userToken models.UserToken
+	err := userTokens.FindOneAndUpdate(ctx,
+		bson.M{
+			"tokenHash": hashToken(token),
+			"purpose":   purpose,
+			"usedAt":    bson.M{"$exists": false},
+			"expiresAt": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&userToken)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return userToken, ErrInvalidUserToken
+	}
+	return userToken, err
+}
+
+// FindUserToken returns a token that can still be used, without using it up.
+func FindUserToken(ctx context.Context, userTokens *mongo.Collection, token, purpose string) (models.UserToken, error) {
+	var userToken models.UserToken
+	err := userTokens.FindOne(ctx, bson.M{
+		"tokenHash": hashToken(token),
+		"purpose":   purpose,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Decode(&userToken)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return userToken, ErrInvalidUserToken
+	}
+	return userToken, err
+}
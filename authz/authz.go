@@ -0,0 +1,166 @@
+// Package authz decides what a signed-in user may do within a group.
+package authz
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+)
+
+// ErrForbidden is returned when a user is not allowed to perform an operation.
+var ErrForbidden = errors.New("forbidden")
+
+// IsMember reports whether the user belongs to the group.
+func IsMember(group models.Group, userID primitive.ObjectID) bool {
+	for _, id := range group.Users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleOf returns the role of a member of the group, or "" for anyone else. Groups created
+// before roles existed have no owner on record, so their creator owns them.
+func RoleOf(group models.Group, userID primitive.ObjectID) models.Role {
+	if !IsMember(group, userID) {
+		return ""
+	}
+	if role, ok := group.Roles[userID.Hex()]; ok {
+		return role
+	}
+	if userID == group.Creator && Owner(group) == primitive.NilObjectID {
+		return models.RoleOwner
+	}
+	return models.RoleMember
+}
+
+// Owner returns the member recorded as the owner of the group, if any.
+func Owner(group models.Group) primitive.ObjectID {
+	for _, id := range group.Users {
+		if group.Roles[id.Hex()] == models.RoleOwner {
+			return id
+		}
+	}
+	return primitive.NilObjectID
+}
+
+// IsOwner reports whether the user owns the group.
+func IsOwner(group models.Group, userID primitive.ObjectID) bool {
+	return RoleOf(group, userID) == models.RoleOwner
+}
+
+// IsAdmin reports whether the user administers the group, which its owner does too.
+func IsAdmin(group models.Group, userID primitive.ObjectID) bool {
+	role := RoleOf(group, userID)
+	return role == models.RoleOwner || role == models.RoleAdmin
+}
+
+// CanView allows members to read a group and everything recorded in it.
+func CanView(group models.Group, userID primitive.ObjectID) error {
+	if !IsMember(group, userID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanAddExpense allows members other than viewers to record expenses and settlements in a group.
+func CanAddExpense(group models.Group, userID primitive.ObjectID) error {
+	if role := RoleOf(group, userID); role == "" || role == models.RoleViewer {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanAddMember allows members other than viewers to add other people to a group.
+func CanAddMember(group models.Group, userID primitive.ObjectID) error {
+	return CanAddExpense(group, userID)
+}
+
+// CanRemoveMember allows members to leave a group, and a group admin to remove anyone else
+// but the owner and, unless they are the owner, other admins.
+func CanRemoveMember(group models.Group, memberID primitive.ObjectID, userID primitive.ObjectID) error {
+	if memberID == userID {
+		return CanView(group, userID)
+	}
+	if !outranks(group, userID, memberID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanChangeRole allows a group admin to give a member they outrank a role below their own.
+// Only the owner can make someone an admin, and making someone the owner transfers
+// ownership to them.
+func CanChangeRole(group models.Group, memberID primitive.ObjectID, role models.Role, userID primitive.ObjectID) error {
+	if memberID == userID || !outranks(group, userID, memberID) {
+		return ErrForbidden
+	}
+	if role == models.RoleOwner {
+		if !IsOwner(group, userID) {
+			return ErrForbidden
+		}
+		return nil
+	}
+	if rank(role) >= rank(RoleOf(group, userID)) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanManageGroup allows a group admin to rename a group and change its settings.
+func CanManageGroup(group models.Group, userID primitive.ObjectID) error {
+	if !IsAdmin(group, userID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanDeleteGroup allows the owner of a group to delete it.
+func CanDeleteGroup(group models.Group, userID primitive.ObjectID) error {
+	if !IsOwner(group, userID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CanModifyExpense allows the member who created an expense, or a group admin,
+// to change or delete it. Viewers cannot change expenses, even their own.
+func CanModifyExpense(group models.Group, expense models.Expense, userID primitive.ObjectID) error {
+	return canModify(group, expense.CreatedBy, userID)
+}
+
+// CanModifySettlement allows the member who recorded a settlement, or a group admin,
+// to delete it.
+func CanModifySettlement(group models.Group, settlement models.Settlement, userID primitive.ObjectID) error {
+	return canModify(group, settlement.CreatedBy, userID)
+}
+
+func canModify(group models.Group, createdBy primitive.ObjectID, userID primitive.ObjectID) error {
+	if CanAddExpense(group, userID) != nil {
+		return ErrForbidden
+	}
+	if createdBy != userID && !IsAdmin(group, userID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// outranks reports whether the user is a group admin with a higher role than the member.
+func outranks(group models.Group, userID primitive.ObjectID, memberID primitive.ObjectID) bool {
+	return IsAdmin(group, userID) && rank(RoleOf(group, userID)) > rank(RoleOf(group, memberID))
+}
+
+func rank(role models.Role) int {
+	switch role {
+	case models.RoleOwner:
+		return 4
+	case models.RoleAdmin:
+		return 3
+	case models.RoleMember:
+		return 2
+	case models.RoleViewer:
+		return 1
+	}
+	return 0
+}
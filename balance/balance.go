@@ -0,0 +1,281 @@
+// Package balance computes each member's net position in a group from its expenses and settlements.
+package balance
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/settle"
+	"mySplitBackEnd/split"
+	"sort"
+	"strings"
+)
+
+// Balance is a user's net position within a group.
+// A positive Net means the user is owed money, a negative Net means the user owes money.
+type Balance struct {
+	UserID   primitive.ObjectID `json:"userId"`
+	Paid     models.Money       `json:"paid"`     // Total amount the user paid for the group
+	Owed     models.Money       `json:"owed"`     // Total of the user's shares across all splits
+	Sent     models.Money       `json:"sent"`     // Total the user paid back to others through settlements
+	Received models.Money       `json:"received"` // Total the user was paid back by others through settlements
+	Net      models.Money       `json:"net"`      // Paid minus Owed, adjusted by settlements
+}
+
+// MissingRateError is returned when expenses or settlements in another currency have no
+// exchange rate stored with them, so they cannot be converted.
+type MissingRateError struct {
+	Currencies []string // Currencies of the amounts that could not be converted, sorted
+}
+
+func (e *MissingRateError) Error() string {
+	return "no exchange rate is recorded for amounts in " + strings.Join(e.Currencies, ", ")
+}
+
+// converter converts amounts into a currency, noting the currencies it had no rate for.
+type converter struct {
+	currency string
+	missing  map[string]bool
+}
+
+// err returns a MissingRateError naming the currencies that could not be converted, if any.
+func (c *converter) err() error {
+	if len(c.missing) == 0 {
+		return nil
+	}
+	currencies := make([]string, 0, len(c.missing))
+	for currency := range c.missing {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return &MissingRateError{Currencies: currencies}
+}
+
+// Compute nets the amount every user paid against their split shares and
+// applies the settlements recorded between users, reporting every amount in currency.
+// Expenses and settlements in another currency are converted at the exchange rate stored
+// with them; documents recorded before currencies were tracked are taken as already
+// being in currency. A MissingRateError is returned when any other amount has no rate.
+// Every member is reported, even with a zero balance; users that appear in
+// expenses but are no longer members are appended after the members.
+func Compute(members []primitive.ObjectID, expenses []models.Expense, settlements []models.Settlement, currency string) ([]Balance, error) {
+	c := converter{currency: currency}
+	index := make(map[primitive.ObjectID]int)
+	var balances []Balance
+	entry := func(userID primitive.ObjectID) *Balance {
+		i, ok := index[userID]
+		if !ok {
+			i = len(balances)
+			index[userID] = i
+			balances = append(balances, Balance{UserID: userID})
+		}
+		return &balances[i]
+	}
+
+	for _, userID := range members {
+		entry(userID)
+	}
+	memberCount := len(balances)
+
+	for _, expense := range expenses {
+		payments, shares := c.convertExpense(expense)
+		for i, p := range expense.Payments() {
+			b := entry(p.UserID)
+			b.Paid = b.Paid.Add(payments[i])
+		}
+		for i, s := range expense.Split {
+			b := entry(s.UserID)
+			b.Owed = b.Owed.Add(shares[i])
+		}
+	}
+	for _, settlement := range settlements {
+		amount := c.convert(settlement.Amount, settlement.ExchangeRate)
+		b := entry(settlement.PaidBy)
+		b.Sent = b.Sent.Add(amount)
+		b = entry(settlement.PaidTo)
+		b.Received = b.Received.Add(amount)
+	}
+
+	// Keep the output stable for users who are not members any more
+	others := balances[memberCount:]
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].UserID.Hex() < others[j].UserID.Hex()
+	})
+
+	for i := range balances {
+		b := &balances[i]
+		b.Paid = b.Paid.WithCurrency(currency)
+		b.Owed = b.Owed.WithCurrency(currency)
+		b.Sent = b.Sent.WithCurrency(currency)
+		b.Received = b.Received.WithCurrency(currency)
+		b.Net = b.Paid.Sub(b.Owed).Add(b.Sent).Sub(b.Received)
+	}
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+// ComputeByCurrency computes balances separately for every currency used in the group,
+// without any conversion. Documents without a currency are reported under fallback.
+func ComputeByCurrency(members []primitive.ObjectID, expenses []models.Expense, settlements []models.Settlement, fallback string) map[string][]Balance {
+	expensesByCurrency := make(map[string][]models.Expense)
+	for _, expense := range expenses {
+		currency := currencyOf(expense.Amount, fallback)
+		expensesByCurrency[currency] = append(expensesByCurrency[currency], expense)
+	}
+	settlementsByCurrency := make(map[string][]models.Settlement)
+	for _, settlement := range settlements {
+		currency := currencyOf(settlement.Amount, fallback)
+		settlementsByCurrency[currency] = append(settlementsByCurrency[currency], settlement)
+	}
+
+	// Nothing is converted, so no rate can be missing
+	result := make(map[string][]Balance)
+	for currency, expenses := range expensesByCurrency {
+		result[currency], _ = Compute(members, expenses, settlementsByCurrency[currency], currency)
+	}
+	for currency, settlements := range settlementsByCurrency {
+		if _, ok := result[currency]; !ok {
+			result[currency], _ = Compute(members, nil, settlements, currency)
+		}
+	}
+	return result
+}
+
+// Debts works out what each user owes each other user directly, without simplifying debts
+// across the group: everyone owes the payers of an expense their share of it, divided in
+// proportion to what each payer paid, and settlements pay these debts back. Debts between
+// two users in opposite directions cancel out. Amounts are converted into currency as in
+// Compute, and the debts are returned as the transfers that settle them, largest first.
+func Debts(expenses []models.Expense, settlements []models.Settlement, currency string) ([]settle.Transfer, error) {
+	c := converter{currency: currency}
+	type pair struct{ from, to primitive.ObjectID }
+	owed := make(map[pair]int64)
+	add := func(from, to primitive.ObjectID, minor int64) {
+		if from == to || minor == 0 {
+			return
+		}
+		// Each pair of users has a single entry, whose sign tells who owes whom
+		if from.Hex() > to.Hex() {
+			from, to, minor = to, from, -minor
+		}
+		owed[pair{from, to}] += minor
+	}
+
+	for _, expense := range expenses {
+		payers := expense.Payments()
+		payments, shares := c.convertExpense(expense)
+		for i, s := range expense.Split {
+			for j, part := range distribute(shares[i], payments) {
+				add(s.UserID, payers[j].UserID, part.Minor)
+			}
+		}
+	}
+	for _, settlement := range settlements {
+		amount := c.convert(settlement.Amount, settlement.ExchangeRate)
+		add(settlement.PaidTo, settlement.PaidBy, amount.Minor)
+	}
+
+	transfers := []settle.Transfer{}
+	for p, minor := range owed {
+		switch {
+		case minor > 0:
+			transfers = append(transfers, settle.Transfer{From: p.from, To: p.to, Amount: models.NewMoney(minor, currency)})
+		case minor < 0:
+			transfers = append(transfers, settle.Transfer{From: p.to, To: p.from, Amount: models.NewMoney(-minor, currency)})
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		a, b := transfers[i], transfers[j]
+		if a.Amount.Minor != b.Amount.Minor {
+			return a.Amount.Minor > b.Amount.Minor
+		}
+		if a.From != b.From {
+			return a.From.Hex() < b.From.Hex()
+		}
+		return a.To.Hex() < b.To.Hex()
+	})
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// convertExpense converts what each payer paid and each split share of an expense.
+// Both are derived from the converted total in proportion to the original amounts, so they
+// still add up to exactly the converted amount.
+func (c *converter) convertExpense(expense models.Expense) ([]models.Money, []models.Money) {
+	payments := make([]models.Money, len(expense.Payments()))
+	for i, p := range expense.Payments() {
+		payments[i] = p.Amount
+	}
+	shares := make([]models.Money, len(expense.Split))
+	for i, s := range expense.Split {
+		shares[i] = s.Amount
+	}
+
+	if !needsConversion(expense.Amount, c.currency) {
+		return relabel(payments, c.currency), relabel(shares, c.currency)
+	}
+	total := c.convert(expense.Amount, expense.ExchangeRate)
+	return distribute(total, payments), distribute(total, shares)
+}
+
+// relabel returns the amounts labelled with currency.
+func relabel(amounts []models.Money, currency string) []models.Money {
+	for i := range amounts {
+		amounts[i] = amounts[i].WithCurrency(currency)
+	}
+	return amounts
+}
+
+// distribute divides total in proportion to parts.
+func distribute(total models.Money, parts []models.Money) []models.Money {
+	weights := make([]float64, len(parts))
+	var sum float64
+	for i, part := range parts {
+		weights[i] = float64(part.Minor)
+		sum += weights[i]
+	}
+
+	result := make([]models.Money, len(parts))
+	if sum <= 0 {
+		for i := range result {
+			result[i] = models.NewMoney(0, total.Currency)
+		}
+		return result
+	}
+	for i, minor := range split.Allocate(total.Minor, weights) {
+		result[i] = models.NewMoney(minor, total.Currency)
+	}
+	return result
+}
+
+// convert converts an amount at the given rate. Without a rate the amount's currency is
+// noted as missing and it counts as zero.
+func (c *converter) convert(amount models.Money, rate float64) models.Money {
+	if !needsConversion(amount, c.currency) {
+		return amount.WithCurrency(c.currency)
+	}
+	if rate <= 0 {
+		if c.missing == nil {
+			c.missing = make(map[string]bool)
+		}
+		c.missing[amount.Currency] = true
+		return models.NewMoney(0, c.currency)
+	}
+	return models.MoneyFromMajor(amount.Major()*rate, c.currency)
+}
+
+// needsConversion reports whether an amount is in a different currency and has to be converted.
+func needsConversion(amount models.Money, currency string) bool {
+	return amount.Currency != "" && currency != "" && amount.Currency != currency
+}
+
+// currencyOf returns the amount's currency, or fallback when it has none.
+func currencyOf(amount models.Money, fallback string) string {
+	if amount.Currency == "" {
+		return fallback
+	}
+	return amount.Currency
+}
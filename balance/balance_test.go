@@ -0,0 +1,286 @@
+package balance
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"reflect"
+	"testing"
+)
+
+// user returns a fixed ObjectID, so that users sort in a known order.
+func user(n byte) primitive.ObjectID {
+	return primitive.ObjectID{11: n}
+}
+
+func eur(minor int64) models.Money {
+	return models.NewMoney(minor, "EUR")
+}
+
+// nets maps each user to their net balance in minor units.
+func nets(balances []Balance) map[primitive.ObjectID]int64 {
+	result := make(map[primitive.ObjectID]int64)
+	for _, b := range balances {
+		result[b.UserID] = b.Net.Minor
+	}
+	return result
+}
+
+func TestCompute(t *testing.T) {
+	a, b, c := user(1), user(2), user(3)
+	members := []primitive.ObjectID{a, b, c}
+	dinner := models.Expense{
+		PaidBy: a,
+		Amount: eur(9000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(3000)}, {UserID: b, Amount: eur(3000)}, {UserID: c, Amount: eur(3000)}},
+	}
+	taxi := models.Expense{
+		PaidBy: b,
+		Amount: eur(2000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(1000)}, {UserID: b, Amount: eur(1000)}},
+	}
+
+	tests := []struct {
+		name        string
+		expenses    []models.Expense
+		settlements []models.Settlement
+		want        map[primitive.ObjectID]int64
+	}{
+		{
+			name: "no expenses",
+			want: map[primitive.ObjectID]int64{a: 0, b: 0, c: 0},
+		},
+		{
+			name:     "payer is owed the shares of the others",
+			expenses: []models.Expense{dinner},
+			want:     map[primitive.ObjectID]int64{a: 6000, b: -3000, c: -3000},
+		},
+		{
+			name:     "expenses add up",
+			expenses: []models.Expense{dinner, taxi},
+			want:     map[primitive.ObjectID]int64{a: 5000, b: -2000, c: -3000},
+		},
+		{
+			name:        "settlements pay debts back",
+			expenses:    []models.Expense{dinner, taxi},
+			settlements: []models.Settlement{{PaidBy: c, PaidTo: a, Amount: eur(3000)}},
+			want:        map[primitive.ObjectID]int64{a: 2000, b: -2000, c: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances, err := Compute(members, tt.expenses, tt.settlements, "EUR")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := nets(balances)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Compute() returned %d balances, want %d", len(got), len(tt.want))
+			}
+			var total int64
+			for userID, want := range tt.want {
+				if got[userID] != want {
+					t.Errorf("net of %s = %d, want %d", userID.Hex(), got[userID], want)
+				}
+				total += got[userID]
+			}
+			if total != 0 {
+				t.Errorf("balances sum to %d, want 0", total)
+			}
+			for _, b := range balances {
+				if b.Net.Currency != "EUR" {
+					t.Errorf("balance of %s is in %q, want EUR", b.UserID.Hex(), b.Net.Currency)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeSeveralPayers(t *testing.T) {
+	a, b, c := user(1), user(2), user(3)
+	expenses := []models.Expense{{
+		PaidBy: a,
+		Payers: []models.Payer{{UserID: a, Amount: eur(2000)}, {UserID: b, Amount: eur(1000)}},
+		Amount: eur(3000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(1000)}, {UserID: b, Amount: eur(1000)}, {UserID: c, Amount: eur(1000)}},
+	}}
+
+	balances, err := Compute([]primitive.ObjectID{a, b, c}, expenses, nil, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nets(balances)
+	if got[a] != 1000 || got[b] != 0 || got[c] != -1000 {
+		t.Fatalf("nets = %v, want a 1000, b 0 and c -1000", got)
+	}
+}
+
+func TestComputeListsMembersFirst(t *testing.T) {
+	a, b, left, gone := user(1), user(2), user(8), user(9)
+	expenses := []models.Expense{{
+		PaidBy: gone,
+		Amount: eur(3000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(1000)}, {UserID: left, Amount: eur(1000)}, {UserID: gone, Amount: eur(1000)}},
+	}}
+
+	balances, err := Compute([]primitive.ObjectID{b, a}, expenses, nil, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []primitive.ObjectID{b, a, left, gone}
+	if len(balances) != len(want) {
+		t.Fatalf("Compute() returned %d balances, want %d", len(balances), len(want))
+	}
+	for i, userID := range want {
+		if balances[i].UserID != userID {
+			t.Errorf("balance %d is for %s, want %s", i, balances[i].UserID.Hex(), userID.Hex())
+		}
+	}
+}
+
+func TestComputeConvertsCurrencies(t *testing.T) {
+	a, b := user(1), user(2)
+	jpy := func(minor int64) models.Money { return models.NewMoney(minor, "JPY") }
+	expenses := []models.Expense{
+		{
+			// 3000 JPY at 0.006 EUR per JPY is 18.00 EUR
+			PaidBy:       a,
+			Amount:       jpy(3000),
+			ExchangeRate: 0.006,
+			Split:        []models.ExpenseSplit{{UserID: a, Amount: jpy(1000)}, {UserID: b, Amount: jpy(2000)}},
+		},
+		{
+			PaidBy: b,
+			Amount: eur(1000),
+			Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(500)}, {UserID: b, Amount: eur(500)}},
+		},
+	}
+	settlements := []models.Settlement{{PaidBy: b, PaidTo: a, Amount: jpy(500), ExchangeRate: 0.006}}
+
+	balances, err := Compute([]primitive.ObjectID{a, b}, expenses, settlements, "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nets(balances)
+	// a: paid 1800, owes 600 + 500, received 300; b is the opposite
+	if got[a] != 400 || got[b] != -400 {
+		t.Fatalf("nets = %v, want a 400 and b -400", got)
+	}
+
+	byCurrency := ComputeByCurrency([]primitive.ObjectID{a, b}, expenses, settlements, "EUR")
+	if n := nets(byCurrency["JPY"]); n[a] != 1500 || n[b] != -1500 {
+		t.Errorf("JPY nets = %v, want a 1500 and b -1500", n)
+	}
+	if n := nets(byCurrency["EUR"]); n[a] != -500 || n[b] != 500 {
+		t.Errorf("EUR nets = %v, want a -500 and b 500", n)
+	}
+}
+
+func TestMissingRate(t *testing.T) {
+	a, b := user(1), user(2)
+	jpy := func(minor int64) models.Money { return models.NewMoney(minor, "JPY") }
+	usd := func(minor int64) models.Money { return models.NewMoney(minor, "USD") }
+	expenses := []models.Expense{
+		{
+			PaidBy: a,
+			Amount: jpy(3000),
+			Split:  []models.ExpenseSplit{{UserID: a, Amount: jpy(1500)}, {UserID: b, Amount: jpy(1500)}},
+		},
+		{
+			PaidBy:       b,
+			Amount:       eur(1000),
+			ExchangeRate: 1.1,
+			Split:        []models.ExpenseSplit{{UserID: a, Amount: eur(500)}, {UserID: b, Amount: eur(500)}},
+		},
+	}
+	settlements := []models.Settlement{{PaidBy: b, PaidTo: a, Amount: eur(100)}}
+	want := []string{"EUR", "JPY"}
+
+	_, err := Compute([]primitive.ObjectID{a, b}, expenses, settlements, "USD")
+	var missing *MissingRateError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Currencies, want) {
+		t.Errorf("Compute() error = %v, want missing rates for %v", err, want)
+	}
+	_, err = Debts(expenses, settlements, "USD")
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Currencies, want) {
+		t.Errorf("Debts() error = %v, want missing rates for %v", err, want)
+	}
+
+	// Amounts in the group currency itself need no rate
+	if _, err := Compute([]primitive.ObjectID{a, b}, []models.Expense{{PaidBy: a, Amount: usd(100), Split: []models.ExpenseSplit{{UserID: b, Amount: usd(100)}}}}, nil, "USD"); err != nil {
+		t.Errorf("Compute() in the group currency: %v", err)
+	}
+}
+
+func TestDebts(t *testing.T) {
+	a, b, c := user(1), user(2), user(3)
+	dinner := models.Expense{
+		PaidBy: a,
+		Amount: eur(9000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(3000)}, {UserID: b, Amount: eur(3000)}, {UserID: c, Amount: eur(3000)}},
+	}
+	taxi := models.Expense{
+		PaidBy: b,
+		Amount: eur(2000),
+		Split:  []models.ExpenseSplit{{UserID: a, Amount: eur(1000)}, {UserID: b, Amount: eur(1000)}},
+	}
+	shared := models.Expense{
+		PaidBy: a,
+		Payers: []models.Payer{{UserID: a, Amount: eur(3000)}, {UserID: b, Amount: eur(1000)}},
+		Amount: eur(4000),
+		Split:  []models.ExpenseSplit{{UserID: c, Amount: eur(4000)}},
+	}
+
+	type debt struct {
+		from, to primitive.ObjectID
+		minor    int64
+	}
+	tests := []struct {
+		name        string
+		expenses    []models.Expense
+		settlements []models.Settlement
+		want        []debt
+	}{
+		{name: "nothing owed", want: []debt{}},
+		{
+			name:     "everyone owes the payer",
+			expenses: []models.Expense{dinner},
+			want:     []debt{{b, a, 3000}, {c, a, 3000}},
+		},
+		{
+			name:     "opposite debts cancel out",
+			expenses: []models.Expense{dinner, taxi},
+			want:     []debt{{c, a, 3000}, {b, a, 2000}},
+		},
+		{
+			name:     "shares owed to payers in proportion to what they paid",
+			expenses: []models.Expense{shared},
+			want:     []debt{{c, a, 3000}, {c, b, 1000}},
+		},
+		{
+			name:        "settlements pay debts back",
+			expenses:    []models.Expense{dinner},
+			settlements: []models.Settlement{{PaidBy: b, PaidTo: a, Amount: eur(3000)}, {PaidBy: c, PaidTo: a, Amount: eur(1000)}},
+			want:        []debt{{c, a, 2000}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfers, err := Debts(tt.expenses, tt.settlements, "EUR")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(transfers) != len(tt.want) {
+				t.Fatalf("Debts() = %v, want %d transfers", transfers, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := transfers[i]
+				if got.From != want.from || got.To != want.to || got.Amount != eur(want.minor) {
+					t.Errorf("transfer %d = %s pays %s %v, want %s pays %s %d", i, got.From.Hex(), got.To.Hex(), got.Amount, want.from.Hex(), want.to.Hex(), want.minor)
+				}
+			}
+		})
+	}
+}
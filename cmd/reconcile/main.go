@@ -0,0 +1,46 @@
+// Command reconcile repairs the membership of users in groups by bringing every
+// User.Groups in line with the members listed in Group.Users. It reads the same
+// configuration as the server.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"mySplitBackEnd/config"
+	"mySplitBackEnd/db"
+	"mySplitBackEnd/membership"
+	"os"
+)
+
+func main() {
+	configPath := flag.String("config", os.Getenv("MYSPLIT_CONFIG"), "path to a YAML or JSON config file")
+	dryRun := flag.Bool("dry-run", false, "report inconsistencies without fixing them")
+	flag.Parse()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := db.Connect(cfg.MongoURI)
+	defer client.Disconnect(context.TODO())
+	database := client.Database(cfg.Database)
+
+	report, err := membership.Reconcile(context.TODO(), db.GetUsersCollection(database), db.GetGroupsCollection(database), *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	action := "Fixed"
+	if *dryRun {
+		action = "Would fix"
+	}
+	for _, fix := range report.UsersFixed {
+		fmt.Printf("%s user %s: added groups %v, removed groups %v\n", action, fix.UserID.Hex(), fix.Added, fix.Removed)
+	}
+	for _, missing := range report.MissingMembers {
+		fmt.Printf("Group %s lists user %s, who does not exist\n", missing.GroupID.Hex(), missing.UserID.Hex())
+	}
+	fmt.Printf("Scanned %d groups and %d users; %s %d users\n", report.GroupsScanned, report.UsersScanned, action, len(report.UsersFixed))
+}
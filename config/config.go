@@ -0,0 +1,317 @@
+// Package config loads the server settings from environment variables and an optional file.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"mySplitBackEnd/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting the server needs to run.
+type Config struct {
+	Port                 string         `json:"port" yaml:"port"`                                 // Address the HTTP server listens on, e.g. ":8080"
+	MongoURI             string         `json:"mongoUri" yaml:"mongoUri"`                         // Connection string of the MongoDB deployment
+	Database             string         `json:"database" yaml:"database"`                         // Name of the MongoDB database
+	JWTSecret            string         `json:"jwtSecret" yaml:"jwtSecret"`                       // HMAC secret for HS256 tokens, used when no signing keys are configured
+	OTPSecret            string         `json:"otpSecret" yaml:"otpSecret"`                       // HMAC key sign-in codes are stored under; jwtSecret when empty
+	SigningKeys          []SigningKey   `json:"signingKeys" yaml:"signingKeys"`                   // RS256/EdDSA keys; the first signs new tokens and all of them verify tokens
+	LegacyHS256Until     time.Time      `json:"legacyHs256Until" yaml:"legacyHs256Until"`         // With signing keys, HS256 tokens are still accepted until this time
+	AccessTokenTTL       Duration       `json:"accessTokenTtl" yaml:"accessTokenTtl"`             // How long an access token stays valid
+	RefreshTokenTTL      Duration       `json:"refreshTokenTtl" yaml:"refreshTokenTtl"`           // How long a refresh token can be used
+	PasswordResetTTL     Duration       `json:"passwordResetTtl" yaml:"passwordResetTtl"`         // How long a password reset link can be used
+	EmailVerificationTTL Duration       `json:"emailVerificationTtl" yaml:"emailVerificationTtl"` // How long an email verification link can be used
+	DefaultCurrency      string         `json:"defaultCurrency" yaml:"defaultCurrency"`           // Base currency of groups created without one
+	ExchangeRates        string         `json:"exchangeRates" yaml:"exchangeRates"`               // Where exchange rates come from: "file" for ExchangeRatesFile, "mongo" for dated snapshots in MongoDB
+	ExchangeRatesFile    string         `json:"exchangeRatesFile" yaml:"exchangeRatesFile"`       // JSON file exchange rates are loaded from
+	PublicURL            string         `json:"publicUrl" yaml:"publicUrl"`                       // Base URL of the web app, used in links sent by email
+	MailFrom             string         `json:"mailFrom" yaml:"mailFrom"`                         // Sender address of emails
+	SMTPAddr             string         `json:"smtpAddr" yaml:"smtpAddr"`                         // host:port of the SMTP server; emails are only logged when empty
+	SMTPUsername         string         `json:"smtpUsername" yaml:"smtpUsername"`                 // SMTP user name, if the server requires authentication
+	SMTPPassword         string         `json:"smtpPassword" yaml:"smtpPassword"`                 // SMTP password
+	MailLogFile          string         `json:"mailLogFile" yaml:"mailLogFile"`                   // File logged emails are appended to instead of the server log
+	SMSGatewayURL        string         `json:"smsGatewayUrl" yaml:"smsGatewayUrl"`               // Endpoint text messages are posted to; texts are only logged in development when empty
+	SMSGatewayToken      string         `json:"smsGatewayToken" yaml:"smsGatewayToken"`           // Bearer token of the SMS gateway account
+	SMSFrom              string         `json:"smsFrom" yaml:"smsFrom"`                           // Sender number or name of text messages
+	Development          bool           `json:"development" yaml:"development"`                   // Allows settings only fit for a developer's machine, such as logging text messages
+	OIDCProviders        []OIDCProvider `json:"oidcProviders" yaml:"oidcProviders"`               // OpenID Connect providers users can sign in with
+	RateLimitStore       string         `json:"rateLimitStore" yaml:"rateLimitStore"`             // Where rate limits are kept: "memory" for one instance, "mongo" to share them
+	TrustProxyHeaders    bool           `json:"trustProxyHeaders" yaml:"trustProxyHeaders"`       // Take client IPs from X-Forwarded-For; only set behind a reverse proxy
+	TrustedProxyHops     int            `json:"trustedProxyHops" yaml:"trustedProxyHops"`         // Number of reverse proxies that append to X-Forwarded-For in front of the server
+}
+
+// OIDCProvider is an OpenID Connect provider, such as Google or Apple, users can sign in with.
+// The client secret can also be given as MYSPLIT_OIDC_<NAME>_CLIENT_SECRET.
+type OIDCProvider struct {
+	Name         string   `json:"name" yaml:"name"`                 // Name used in the sign-in URLs, e.g. "google"
+	Issuer       string   `json:"issuer" yaml:"issuer"`             // Issuer URL the provider's metadata is discovered from
+	ClientID     string   `json:"clientId" yaml:"clientId"`         // Client ID registered with the provider
+	ClientSecret string   `json:"clientSecret" yaml:"clientSecret"` // Client secret registered with the provider, if it issued one
+	RedirectURL  string   `json:"redirectUrl" yaml:"redirectUrl"`   // Page of the web app the provider sends the user back to
+	Scopes       []string `json:"scopes" yaml:"scopes"`             // Scopes to request; "openid email profile" when empty
+}
+
+// SigningKey is a PEM file holding a key used for access tokens. Private keys (PKCS#1 or
+// PKCS#8, RSA or Ed25519) can sign and verify; public keys (PKIX) only verify, which is
+// how a retired key is kept around until the tokens it signed have expired.
+type SigningKey struct {
+	ID   string `json:"id" yaml:"id"`     // Key ID written to the "kid" header of tokens
+	File string `json:"file" yaml:"file"` // Path to the PEM file
+}
+
+// Duration is a time.Duration written as a string such as "15m" or "720h" in config files.
+type Duration time.Duration
+
+// UnmarshalText parses a duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration as a string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default returns the settings used for anything not configured explicitly.
+// There is no default JWT secret or signing key, so one of them must always be configured.
+func Default() Config {
+	return Config{
+		Port:                 ":8080",
+		MongoURI:             "mongodb://localhost:27017",
+		Database:             "mySplit",
+		AccessTokenTTL:       Duration(15 * time.Minute),
+		RefreshTokenTTL:      Duration(30 * 24 * time.Hour),
+		PasswordResetTTL:     Duration(time.Hour),
+		EmailVerificationTTL: Duration(48 * time.Hour),
+		DefaultCurrency:      "USD",
+		ExchangeRates:        "file",
+		ExchangeRatesFile:    "exchange_rates.json",
+		PublicURL:            "http://localhost:8080",
+		MailFrom:             "mySplit <no-reply@localhost>",
+		RateLimitStore:       "memory",
+		TrustedProxyHops:     1,
+	}
+}
+
+// Load builds the configuration from the defaults, then the file at path if path is not
+// empty, then the MYSPLIT_* environment variables, each overriding the previous ones.
+// Files ending in .yaml or .yml are read as YAML, anything else as JSON.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if err := loadEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	cfg.DefaultCurrency = strings.ToUpper(cfg.DefaultCurrency)
+	if cfg.OTPSecret == "" {
+		cfg.OTPSecret = cfg.JWTSecret
+	}
+	for i, provider := range cfg.OIDCProviders {
+		if provider.RedirectURL == "" {
+			cfg.OIDCProviders[i].RedirectURL = strings.TrimRight(cfg.PublicURL, "/") + "/oidc/" + provider.Name + "/callback"
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate reports every setting that is missing or out of range.
+func (c Config) Validate() error {
+	var problems []string
+	if c.Port == "" {
+		problems = append(problems, "port is required")
+	}
+	if c.MongoURI == "" {
+		problems = append(problems, "mongoUri is required")
+	}
+	if c.Database == "" {
+		problems = append(problems, "database is required")
+	}
+	if len(c.SigningKeys) == 0 || !c.LegacyHS256Until.IsZero() {
+		if len(c.JWTSecret) < 32 {
+			problems = append(problems, "jwtSecret must be at least 32 characters long")
+		}
+	}
+	if len(c.OTPSecret) < 32 {
+		problems = append(problems, "otpSecret must be at least 32 characters long, or jwtSecret set instead")
+	}
+	keyIDs := make(map[string]bool)
+	for i, key := range c.SigningKeys {
+		if key.ID == "" || key.File == "" {
+			problems = append(problems, fmt.Sprintf("signingKeys[%d] needs both an id and a file", i))
+		}
+		if keyIDs[key.ID] {
+			problems = append(problems, fmt.Sprintf("signingKeys[%d] reuses the id %q", i, key.ID))
+		}
+		keyIDs[key.ID] = true
+	}
+	if c.AccessTokenTTL <= 0 {
+		problems = append(problems, "accessTokenTtl must be positive")
+	}
+	if c.RefreshTokenTTL <= c.AccessTokenTTL {
+		problems = append(problems, "refreshTokenTtl must be longer than accessTokenTtl")
+	}
+	if c.PasswordResetTTL <= 0 {
+		problems = append(problems, "passwordResetTtl must be positive")
+	}
+	if c.EmailVerificationTTL <= 0 {
+		problems = append(problems, "emailVerificationTtl must be positive")
+	}
+	if !models.IsCurrency(c.DefaultCurrency) {
+		problems = append(problems, "defaultCurrency must be an ISO 4217 currency code")
+	}
+	if c.ExchangeRates != "file" && c.ExchangeRates != "mongo" {
+		problems = append(problems, `exchangeRates must be "file" or "mongo"`)
+	}
+	if c.PublicURL == "" {
+		problems = append(problems, "publicUrl is required")
+	}
+	if c.SMTPAddr != "" && c.MailFrom == "" {
+		problems = append(problems, "mailFrom is required to send emails")
+	}
+	if c.SMSGatewayURL != "" && c.SMSFrom == "" {
+		problems = append(problems, "smsFrom is required to send text messages")
+	}
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "mongo" {
+		problems = append(problems, `rateLimitStore must be "memory" or "mongo"`)
+	}
+	if c.TrustProxyHeaders && c.TrustedProxyHops < 1 {
+		problems = append(problems, "trustedProxyHops must be at least 1 to trust proxy headers")
+	}
+	providerNames := make(map[string]bool)
+	for i, provider := range c.OIDCProviders {
+		if provider.Name == "" || provider.Issuer == "" || provider.ClientID == "" {
+			problems = append(problems, fmt.Sprintf("oidcProviders[%d] needs a name, an issuer and a clientId", i))
+		}
+		if providerNames[provider.Name] {
+			problems = append(problems, fmt.Sprintf("oidcProviders[%d] reuses the name %q", i, provider.Name))
+		}
+		providerNames[provider.Name] = true
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// loadFile reads settings from a YAML or JSON file.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv reads settings from the MYSPLIT_* environment variables that are set.
+func loadEnv(cfg *Config) error {
+	stringSettings := map[string]*string{
+		"MYSPLIT_PORT":                &cfg.Port,
+		"MYSPLIT_MONGO_URI":           &cfg.MongoURI,
+		"MYSPLIT_DATABASE":            &cfg.Database,
+		"MYSPLIT_JWT_SECRET":          &cfg.JWTSecret,
+		"MYSPLIT_OTP_SECRET":          &cfg.OTPSecret,
+		"MYSPLIT_DEFAULT_CURRENCY":    &cfg.DefaultCurrency,
+		"MYSPLIT_EXCHANGE_RATES":      &cfg.ExchangeRates,
+		"MYSPLIT_EXCHANGE_RATES_FILE": &cfg.ExchangeRatesFile,
+		"MYSPLIT_PUBLIC_URL":          &cfg.PublicURL,
+		"MYSPLIT_MAIL_FROM":           &cfg.MailFrom,
+		"MYSPLIT_SMTP_ADDR":           &cfg.SMTPAddr,
+		"MYSPLIT_SMTP_USERNAME":       &cfg.SMTPUsername,
+		"MYSPLIT_SMTP_PASSWORD":       &cfg.SMTPPassword,
+		"MYSPLIT_MAIL_LOG_FILE":       &cfg.MailLogFile,
+		"MYSPLIT_SMS_GATEWAY_URL":     &cfg.SMSGatewayURL,
+		"MYSPLIT_SMS_GATEWAY_TOKEN":   &cfg.SMSGatewayToken,
+		"MYSPLIT_SMS_FROM":            &cfg.SMSFrom,
+		"MYSPLIT_RATE_LIMIT_STORE":    &cfg.RateLimitStore,
+	}
+	for name, field := range stringSettings {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	// Signing keys are listed as id=file pairs separated by commas, the signing key first
+	if value, ok := os.LookupEnv("MYSPLIT_SIGNING_KEYS"); ok {
+		cfg.SigningKeys = nil
+		for _, pair := range strings.Split(value, ",") {
+			id, file, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found {
+				return fmt.Errorf("MYSPLIT_SIGNING_KEYS: %q is not an id=file pair", pair)
+			}
+			cfg.SigningKeys = append(cfg.SigningKeys, SigningKey{ID: id, File: file})
+		}
+	}
+	for i, provider := range cfg.OIDCProviders {
+		name := "MYSPLIT_OIDC_" + strings.ToUpper(strings.ReplaceAll(provider.Name, "-", "_")) + "_CLIENT_SECRET"
+		if value, ok := os.LookupEnv(name); ok {
+			cfg.OIDCProviders[i].ClientSecret = value
+		}
+	}
+	if value, ok := os.LookupEnv("MYSPLIT_TRUST_PROXY_HEADERS"); ok {
+		trust, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MYSPLIT_TRUST_PROXY_HEADERS: %w", err)
+		}
+		cfg.TrustProxyHeaders = trust
+	}
+	if value, ok := os.LookupEnv("MYSPLIT_DEVELOPMENT"); ok {
+		development, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("MYSPLIT_DEVELOPMENT: %w", err)
+		}
+		cfg.Development = development
+	}
+	if value, ok := os.LookupEnv("MYSPLIT_TRUSTED_PROXY_HOPS"); ok {
+		hops, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("MYSPLIT_TRUSTED_PROXY_HOPS: %w", err)
+		}
+		cfg.TrustedProxyHops = hops
+	}
+	if value, ok := os.LookupEnv("MYSPLIT_LEGACY_HS256_UNTIL"); ok {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("MYSPLIT_LEGACY_HS256_UNTIL: %w", err)
+		}
+		cfg.LegacyHS256Until = until
+	}
+
+	durationSettings := map[string]*Duration{
+		"MYSPLIT_ACCESS_TOKEN_TTL":       &cfg.AccessTokenTTL,
+		"MYSPLIT_REFRESH_TOKEN_TTL":      &cfg.RefreshTokenTTL,
+		"MYSPLIT_PASSWORD_RESET_TTL":     &cfg.PasswordResetTTL,
+		"MYSPLIT_EMAIL_VERIFICATION_TTL": &cfg.EmailVerificationTTL,
+	}
+	for name, field := range durationSettings {
+		if value, ok := os.LookupEnv(name); ok {
+			if err := field.UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("MYSPLIT_JWT_SECRET", secret)
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Default()
+	want.JWTSecret = secret
+	if cfg.OTPSecret != secret {
+		t.Errorf("OTPSecret = %q, want the JWT secret", cfg.OTPSecret)
+	}
+	if cfg.Port != want.Port || cfg.Database != want.Database || cfg.AccessTokenTTL != want.AccessTokenTTL || cfg.RateLimitStore != want.RateLimitStore {
+		t.Fatalf("Load() = %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "config.yaml",
+			content: `
+port: ":9090"
+jwtSecret: "` + secret + `"
+accessTokenTtl: 5m
+defaultCurrency: eur
+oidcProviders:
+  - name: google
+    issuer: https://accounts.google.com
+    clientId: client
+`,
+		},
+		{
+			name:    "config.json",
+			content: `{"port": ":9090", "jwtSecret": "` + secret + `", "accessTokenTtl": "5m", "defaultCurrency": "eur", "oidcProviders": [{"name": "google", "issuer": "https://accounts.google.com", "clientId": "client"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Port != ":9090" || time.Duration(cfg.AccessTokenTTL) != 5*time.Minute {
+				t.Errorf("Load() read port %q and access token TTL %v", cfg.Port, time.Duration(cfg.AccessTokenTTL))
+			}
+			if cfg.Database != "mySplit" {
+				t.Errorf("Database = %q, want the default", cfg.Database)
+			}
+			if cfg.DefaultCurrency != "EUR" {
+				t.Errorf("DefaultCurrency = %q, want EUR", cfg.DefaultCurrency)
+			}
+			if got := cfg.OIDCProviders[0].RedirectURL; got != "http://localhost:8080/oidc/google/callback" {
+				t.Errorf("RedirectURL = %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+port: ":9090"
+jwtSecret: "`+secret+`"
+oidcProviders:
+  - name: sign-in-with-apple
+    issuer: https://appleid.apple.com
+    clientId: client
+`)
+	t.Setenv("MYSPLIT_PORT", ":7070")
+	t.Setenv("MYSPLIT_REFRESH_TOKEN_TTL", "48h")
+	t.Setenv("MYSPLIT_TRUST_PROXY_HEADERS", "true")
+	t.Setenv("MYSPLIT_DEVELOPMENT", "true")
+	t.Setenv("MYSPLIT_SIGNING_KEYS", "new=keys/new.pem, old=keys/old.pem")
+	t.Setenv("MYSPLIT_OIDC_SIGN_IN_WITH_APPLE_CLIENT_SECRET", "apple-secret")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != ":7070" {
+		t.Errorf("Port = %q, want the environment's", cfg.Port)
+	}
+	if time.Duration(cfg.RefreshTokenTTL) != 48*time.Hour {
+		t.Errorf("RefreshTokenTTL = %v", time.Duration(cfg.RefreshTokenTTL))
+	}
+	if !cfg.TrustProxyHeaders {
+		t.Error("TrustProxyHeaders is not set")
+	}
+	if !cfg.Development {
+		t.Error("Development is not set")
+	}
+	if len(cfg.SigningKeys) != 2 || cfg.SigningKeys[0] != (SigningKey{ID: "new", File: "keys/new.pem"}) || cfg.SigningKeys[1].ID != "old" {
+		t.Errorf("SigningKeys = %v", cfg.SigningKeys)
+	}
+	if cfg.OIDCProviders[0].ClientSecret != "apple-secret" {
+		t.Errorf("ClientSecret = %q", cfg.OIDCProviders[0].ClientSecret)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		file string
+	}{
+		{name: "invalid duration", env: map[string]string{"MYSPLIT_ACCESS_TOKEN_TTL": "soon"}},
+		{name: "invalid boolean", env: map[string]string{"MYSPLIT_TRUST_PROXY_HEADERS": "maybe"}},
+		{name: "invalid development flag", env: map[string]string{"MYSPLIT_DEVELOPMENT": "local"}},
+		{name: "invalid number", env: map[string]string{"MYSPLIT_TRUSTED_PROXY_HOPS": "two"}},
+		{name: "invalid signing keys", env: map[string]string{"MYSPLIT_SIGNING_KEYS": "keys/new.pem"}},
+		{name: "invalid time", env: map[string]string{"MYSPLIT_LEGACY_HS256_UNTIL": "tomorrow"}},
+		{name: "invalid file", file: `{"port": `},
+		{name: "invalid settings", env: map[string]string{"MYSPLIT_RATE_LIMIT_STORE": "redis"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MYSPLIT_JWT_SECRET", secret)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, "config.json", tt.file)
+			}
+			if _, err := Load(path); err == nil {
+				t.Fatal("Load() succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.JWTSecret = secret
+		cfg.OTPSecret = secret
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{name: "valid", change: func(c *Config) {}},
+		{name: "signing keys without a secret", change: func(c *Config) {
+			c.JWTSecret = ""
+			c.SigningKeys = []SigningKey{{ID: "a", File: "a.pem"}}
+		}},
+		{name: "short OTP secret", change: func(c *Config) { c.OTPSecret = "short" }, want: "otpSecret"},
+		{name: "short secret", change: func(c *Config) { c.JWTSecret = "short" }, want: "jwtSecret"},
+		{name: "legacy tokens need a secret", change: func(c *Config) {
+			c.JWTSecret = ""
+			c.SigningKeys = []SigningKey{{ID: "a", File: "a.pem"}}
+			c.LegacyHS256Until = time.Now()
+		}, want: "jwtSecret"},
+		{name: "signing key without a file", change: func(c *Config) { c.SigningKeys = []SigningKey{{ID: "a"}} }, want: "signingKeys[0]"},
+		{name: "reused key id", change: func(c *Config) {
+			c.SigningKeys = []SigningKey{{ID: "a", File: "a.pem"}, {ID: "a", File: "b.pem"}}
+		}, want: "signingKeys[1] reuses"},
+		{name: "no port", change: func(c *Config) { c.Port = "" }, want: "port"},
+		{name: "no database", change: func(c *Config) { c.Database = "" }, want: "database"},
+		{name: "refresh shorter than access", change: func(c *Config) { c.RefreshTokenTTL = c.AccessTokenTTL }, want: "refreshTokenTtl"},
+		{name: "password reset TTL", change: func(c *Config) { c.PasswordResetTTL = 0 }, want: "passwordResetTtl"},
+		{name: "no proxy hops", change: func(c *Config) {
+			c.TrustProxyHeaders = true
+			c.TrustedProxyHops = 0
+		}, want: "trustedProxyHops"},
+		{name: "currency", change: func(c *Config) { c.DefaultCurrency = "EURO" }, want: "defaultCurrency"},
+		{name: "unknown currency", change: func(c *Config) { c.DefaultCurrency = "USX" }, want: "defaultCurrency"},
+		{name: "exchange rates", change: func(c *Config) { c.ExchangeRates = "api" }, want: "exchangeRates"},
+		{name: "SMTP without a sender", change: func(c *Config) {
+			c.SMTPAddr = "smtp.example.com:587"
+			c.MailFrom = ""
+		}, want: "mailFrom"},
+		{name: "SMS gateway without a sender", change: func(c *Config) {
+			c.SMSGatewayURL = "https://sms.example.com/messages"
+		}, want: "smsFrom"},
+		{name: "incomplete provider", change: func(c *Config) { c.OIDCProviders = []OIDCProvider{{Name: "google"}} }, want: "oidcProviders[0]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() = %v, want a problem with %s", err, tt.want)
+			}
+		})
+	}
+}
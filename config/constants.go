@@ -1,3 +0,0 @@
-package config
-
-var JwtKey = []byte("myJWTSecretKey_2023!$#*^%&sfdjb2345sfgh")
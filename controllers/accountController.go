@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/mail"
+	"mySplitBackEnd/membership"
+	"mySplitBackEnd/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minPasswordLength = 8
+
+// passwordTooShortMessage is the error for passwords shorter than minPasswordLength.
+var passwordTooShortMessage = "Password must be at least " + strconv.Itoa(minPasswordLength) + " characters long"
+
+// ForgotPassword emails a password reset link to the address, if it belongs to a user.
+// It always responds with 202 Accepted so that it cannot be used to find out which emails are registered.
+func ForgotPassword(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, userTokenCollection *mongo.Collection, mailer mail.Mailer, publicURL string, ttl time.Duration) {
+	var request struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"email": request.Email, "placeholder": bson.M{"$ne": true}}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		token, err := auth.IssueUserToken(context.TODO(), userTokenCollection, user, models.TokenPurposeResetPassword, ttl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		err = mailer.Send(context.TODO(), mail.Message{
+			To:      user.Email,
+			Subject: "Reset your mySplit password",
+			Body: "Someone asked to reset the password of your mySplit account.\n\n" +
+				"Choose a new password within the next " + describeDuration(ttl) + " at:\n" + link(publicURL, "/reset-password", token) + "\n\n" +
+				"If this wasn't you, you can ignore this email.\n",
+		})
+		if err != nil {
+			log.Printf("Could not send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using a token from a password reset email, and signs
+// the user out on every device.
+func ResetPassword(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, userTokenCollection *mongo.Collection, sessionCollection *mongo.Collection, memberships membership.Collections) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(request.Password) < minPasswordLength {
+		http.Error(w, passwordTooShortMessage, http.StatusBadRequest)
+		return
+	}
+
+	userToken, err := auth.ConsumeUserToken(context.TODO(), userTokenCollection, request.Token, models.TokenPurposeResetPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Following the link unlocks the account
+	_, err = collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userToken.UserID},
+		bson.M{
+			"$set":   bson.M{"password": string(hashedPassword), "failedLogins": 0},
+			"$unset": bson.M{"lockedUntil": ""},
+		})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = auth.RevokeAll(context.TODO(), sessionCollection, userToken.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// It also proves the user controls the email address, unless it changed since the link was sent
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userToken.UserID, "email": userToken.Email},
+		bson.M{"$set": bson.M{"emailVerified": true}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount > 0 {
+		claimPlaceholders(memberships, userToken.UserID, true, false)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail marks a user's email address as verified using a token from a verification email.
+func VerifyEmail(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, userTokenCollection *mongo.Collection, memberships membership.Collections) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userToken, err := auth.ConsumeUserToken(context.TODO(), userTokenCollection, request.Token, models.TokenPurposeVerifyEmail)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The token only verifies the address it was sent to
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userToken.UserID, "email": userToken.Email},
+		bson.M{"$set": bson.M{"emailVerified": true}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, auth.ErrInvalidUserToken.Error(), http.StatusBadRequest)
+		return
+	}
+	claimPlaceholders(memberships, userToken.UserID, true, false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerificationEmail sends the signed-in user a new email verification link.
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, userTokenCollection *mongo.Collection, mailer mail.Mailer, publicURL string, ttl time.Duration) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := collection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	err = sendVerificationEmail(userTokenCollection, mailer, publicURL, ttl, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendVerificationEmail emails the user a link that proves they control their email address.
+func sendVerificationEmail(userTokenCollection *mongo.Collection, mailer mail.Mailer, publicURL string, ttl time.Duration, user models.User) error {
+	token, err := auth.IssueUserToken(context.TODO(), userTokenCollection, user, models.TokenPurposeVerifyEmail, ttl)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(context.TODO(), mail.Message{
+		To:      user.Email,
+		Subject: "Verify your mySplit email address",
+		Body: "Welcome to mySplit, " + user.Name + "!\n\n" +
+			"Please confirm this is your email address by opening:\n" + link(publicURL, "/verify-email", token) + "\n",
+	})
+}
+
+// describeDuration writes a link lifetime the way an email would, e.g. "hour" or "2 days".
+func describeDuration(d time.Duration) string {
+	n, unit := int64(d/time.Minute), "minute"
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		n, unit = int64(d/(24*time.Hour)), "day"
+	case d >= time.Hour && d%time.Hour == 0:
+		n, unit = int64(d/time.Hour), "hour"
+	}
+	if n == 1 {
+		return unit
+	}
+	return strconv.FormatInt(n, 10) + " " + unit + "s"
+}
+
+// link builds a URL to a page of the web app carrying a token.
+func link(publicURL, path, token string) string {
+	return strings.TrimRight(publicURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
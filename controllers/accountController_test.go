@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribeDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: time.Hour, want: "hour"},
+		{d: 48 * time.Hour, want: "2 days"},
+		{d: 36 * time.Hour, want: "36 hours"},
+		{d: 90 * time.Minute, want: "90 minutes"},
+		{d: time.Minute, want: "minute"},
+	}
+	for _, tt := range tests {
+		if got := describeDuration(tt.d); got != tt.want {
+			t.Errorf("describeDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/balance"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/settle"
+	"net/http"
+)
+
+// GetGroupBalances returns the net position of every member of a group, converted into
+// the group's currency, along with the unconverted balances for each currency used. When
+// some amounts have no exchange rate, the currencies they are in are listed instead of the
+// converted balances.
+func GetGroupBalances(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	group, _, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+
+	expenses, err := findGroupExpenses(expenseCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settlements, err := findGroupSettlements(settlementCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	balances, err := balance.Compute(group.Users, expenses, settlements, group.Currency)
+	var missing *balance.MissingRateError
+	if err != nil && !errors.As(err, &missing) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		GroupID     string                       `json:"groupId"`
+		Currency    string                       `json:"currency"`
+		Balances    []balance.Balance            `json:"balances"`
+		Unconverted []string                     `json:"unconverted,omitempty"` // Currencies of amounts without an exchange rate
+		ByCurrency  map[string][]balance.Balance `json:"byCurrency"`
+	}{
+		GroupID:    group.ID.Hex(),
+		Currency:   group.Currency,
+		Balances:   balances,
+		ByCurrency: balance.ComputeByCurrency(group.Users, expenses, settlements, group.Currency),
+	}
+	if missing != nil {
+		response.Unconverted = missing.Currencies
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSettlePlan returns the list of payments that settles every balance in a group: the
+// minimal one, unless the group turned debt simplification off.
+func GetSettlePlan(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	group, _, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+
+	expenses, err := findGroupExpenses(expenseCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settlements, err := findGroupSettlements(settlementCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Groups that turned simplification off settle what each member owes each other member
+	var transfers []settle.Transfer
+	if group.SimplifiesDebts() {
+		balances, err := balance.Compute(group.Users, expenses, settlements, group.Currency)
+		if err != nil {
+			writeBalanceError(w, err)
+			return
+		}
+		net := make(map[primitive.ObjectID]models.Money)
+		for _, b := range balances {
+			net[b.UserID] = b.Net
+		}
+		transfers = settle.Simplify(group.Users, net)
+	} else {
+		transfers, err = balance.Debts(expenses, settlements, group.Currency)
+		if err != nil {
+			writeBalanceError(w, err)
+			return
+		}
+	}
+
+	response := struct {
+		GroupID    string            `json:"groupId"`
+		Simplified bool              `json:"simplified"`
+		Transfers  []settle.Transfer `json:"transfers"`
+	}{
+		GroupID:    group.ID.Hex(),
+		Simplified: group.SimplifiesDebts(),
+		Transfers:  transfers,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeBalanceError responds to a failure to work out a group's balances, with 409 Conflict
+// when amounts in another currency have no exchange rate to convert them with.
+func writeBalanceError(w http.ResponseWriter, err error) {
+	var missing *balance.MissingRateError
+	if errors.As(err, &missing) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
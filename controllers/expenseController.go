@@ -3,17 +3,23 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/authz"
+	"mySplitBackEnd/fx"
 	"mySplitBackEnd/models"
+	"mySplitBackEnd/split"
+	"mySplitBackEnd/validation"
 	"net/http"
 	"time"
 )
 
 // CreateExpense handles the creation of a new expense.
-func CreateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+func CreateExpense(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, collection *mongo.Collection, rates fx.RateProvider) {
 	var expense models.Expense
 
 	// Decode the request body into the expense struct
@@ -22,8 +28,13 @@ func CreateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if expense.CreatedBy == primitive.NilObjectID {
-		http.Error(w, "CreatedBy (userId) is required", http.StatusBadRequest)
+	// The signed-in user is recorded as the creator
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	expense.CreatedBy = userID
+	if !prepareExpense(w, groupCollection, rates, userID, &expense, true) {
 		return
 	}
 
@@ -46,8 +57,9 @@ func CreateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 	}
 }
 
-// GetExpense retrieves a single expense by its ID.
-func GetExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+// GetExpense retrieves a single expense by its ID, including the line items of
+// itemized expenses alongside the split derived from them.
+func GetExpense(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, collection *mongo.Collection) {
 	idParam := mux.Vars(r)["id"] // Get ID from URL
 	id, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -61,13 +73,16 @@ func GetExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Collec
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if _, _, ok := loadGroupForMember(w, r, groupCollection, expense.GroupID); !ok {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(expense)
 }
 
 // UpdateExpense updates an existing expense.
-func UpdateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+func UpdateExpense(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, collection *mongo.Collection, rates fx.RateProvider) {
 	idParam := mux.Vars(r)["id"]
 	id, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -75,6 +90,27 @@ func UpdateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 		return
 	}
 
+	var existing models.Expense
+	err = collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&existing)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Expense not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Only the member who created the expense or a group admin may change it
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, existing.GroupID)
+	if !ok {
+		return
+	}
+	if authz.CanModifyExpense(group, existing, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
 	var expense models.Expense
 	err = json.NewDecoder(r.Body).Decode(&expense)
 	if err != nil {
@@ -82,8 +118,20 @@ func UpdateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 		return
 	}
 
+	// An expense keeps its creation details, and stays in its group unless moved explicitly
+	expense.ID = existing.ID
+	expense.CreatedAt = existing.CreatedAt
+	expense.CreatedBy = existing.CreatedBy
+	if expense.GroupID == primitive.NilObjectID {
+		expense.GroupID = existing.GroupID
+	}
+
+	if !prepareExpense(w, groupCollection, rates, userID, &expense, false) {
+		return
+	}
+
 	expense.ModifiedAt = time.Now()
-	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": id}, bson.M{"$set": expense})
+	_, err = collection.UpdateOne(context.TODO(), bson.M{"_id": id}, expenseUpdate(expense))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -93,7 +141,7 @@ func UpdateExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 }
 
 // DeleteExpense deletes an expense.
-func DeleteExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+func DeleteExpense(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, collection *mongo.Collection) {
 	idParam := mux.Vars(r)["id"]
 	id, err := primitive.ObjectIDFromHex(idParam)
 	if err != nil {
@@ -101,6 +149,27 @@ func DeleteExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 		return
 	}
 
+	var expense models.Expense
+	err = collection.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&expense)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Expense not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Only the member who created the expense or a group admin may delete it
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, expense.GroupID)
+	if !ok {
+		return
+	}
+	if authz.CanModifyExpense(group, expense, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
 	_, err = collection.DeleteOne(context.TODO(), bson.M{"_id": id})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -110,8 +179,44 @@ func DeleteExpense(w http.ResponseWriter, r *http.Request, collection *mongo.Col
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// expenseUpdate builds the update that replaces a stored expense with expense. Optional
+// fields are left out of the document when empty, so those are unset explicitly; otherwise
+// the values stored before would outlive the update.
+func expenseUpdate(expense models.Expense) bson.M {
+	unset := bson.M{}
+	if len(expense.Payers) == 0 {
+		unset["payers"] = ""
+	}
+	if expense.ExchangeRate == 0 {
+		unset["exchangeRate"] = ""
+	}
+	if expense.Category == "" {
+		unset["category"] = ""
+	}
+	if expense.SplitMode == "" {
+		unset["splitMode"] = ""
+	}
+	if len(expense.Participants) == 0 {
+		unset["participants"] = ""
+	}
+	if len(expense.Items) == 0 {
+		unset["items"] = ""
+	}
+	if expense.Tax.IsZero() {
+		unset["tax"] = ""
+	}
+	if expense.Tip.IsZero() {
+		unset["tip"] = ""
+	}
+	update := bson.M{"$set": expense}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return update
+}
+
 // GetExpensesByGroup retrieves all expenses for a specific group.
-func GetExpensesByGroup(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+func GetExpensesByGroup(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, collection *mongo.Collection) {
 	// Extract the group ID from URL parameters
 	groupIDParam := mux.Vars(r)["groupId"]
 	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
@@ -119,34 +224,195 @@ func GetExpensesByGroup(w http.ResponseWriter, r *http.Request, collection *mong
 		http.Error(w, "Invalid group ID", http.StatusBadRequest)
 		return
 	}
+	if _, _, ok := loadGroupForMember(w, r, groupCollection, groupID); !ok {
+		return
+	}
 
 	// Find all expenses for the group
-	cursor, err := collection.Find(context.TODO(), bson.M{"groupId": groupID})
+	expenses, err := findGroupExpenses(collection, groupID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	// Respond with the list of expenses
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(expenses)
+}
+
+// normalizeAmounts labels payer, split, item, tax and tip amounts sent without a currency
+// with the expense's currency, and points PaidBy at the main payer of a shared payment.
+func normalizeAmounts(expense *models.Expense) {
+	currency := expense.Amount.Currency
+	for i := range expense.Payers {
+		expense.Payers[i].Amount = expense.Payers[i].Amount.WithCurrency(currency)
+	}
+	main := -1
+	for i, payer := range expense.Payers {
+		if main < 0 || payer.Amount.Minor > expense.Payers[main].Amount.Minor {
+			main = i
+		}
+	}
+	if main >= 0 {
+		expense.PaidBy = expense.Payers[main].UserID
+	}
+	for i := range expense.Split {
+		expense.Split[i].Amount = expense.Split[i].Amount.WithCurrency(currency)
+	}
+	for i := range expense.Items {
+		expense.Items[i].Amount = expense.Items[i].Amount.WithCurrency(currency)
+	}
+	expense.Tax = expense.Tax.WithCurrency(currency)
+	expense.Tip = expense.Tip.WithCurrency(currency)
+}
+
+// applyGroupDefaults fills in the split of an expense sent without one from the group's
+// default split mode and participants. The default participants are also used for an
+// expense sent with the default split mode but no participants. Default participants who
+// left the group are skipped, and without any an equal or shares split is among every member.
+func applyGroupDefaults(expense *models.Expense, group models.Group) {
+	defaultMode := split.Mode(group.Settings.DefaultSplitMode)
+	if defaultMode == "" {
+		defaultMode = split.ModeEqual
+	}
+	if expense.SplitMode == "" && len(expense.Split) == 0 && len(expense.Items) == 0 {
+		expense.SplitMode = string(defaultMode)
+	}
+	mode := split.Mode(expense.SplitMode)
+	if len(expense.Participants) > 0 || len(expense.Split) > 0 {
+		return
+	}
+
+	// Percentages and shares only carry over to expenses split the same way
+	if mode == defaultMode || mode == split.ModeEqual {
+		for _, p := range group.Settings.DefaultParticipants {
+			if authz.IsMember(group, p.UserID) {
+				expense.Participants = append(expense.Participants, p)
+			}
+		}
+	}
+	if len(expense.Participants) == 0 && (mode == split.ModeEqual || mode == split.ModeShares) {
+		for _, userID := range group.Users {
+			expense.Participants = append(expense.Participants, models.SplitParticipant{UserID: userID, Value: 1})
+		}
+	}
+}
+
+// applySplitMode derives the expense's Split from its SplitMode and Participants, or from
+// its Items for itemized expenses, whose Amount defaults to the receipt total.
+// Expenses without a split mode keep the Split amounts sent by the client.
+func applySplitMode(expense *models.Expense) error {
+	switch split.Mode(expense.SplitMode) {
+	case "":
+		return nil
+	case split.ModeItemized:
+		splits, total, err := split.Itemize(expense.Items, expense.Tax, expense.Tip)
+		if err != nil {
+			return err
+		}
+		if expense.Amount.IsZero() {
+			expense.Amount = total
+		} else if expense.Amount.Minor != total.Minor || expense.Amount.Currency != total.Currency {
+			return fmt.Errorf("amount %s does not match the items, tax and tip, which total %s", expense.Amount, total)
+		}
+		expense.Split = splits
+		return nil
+	}
+	splits, err := split.Compute(expense.Amount, split.Mode(expense.SplitMode), expense.Participants)
+	if err != nil {
+		return err
+	}
+	expense.Split = splits
+	return nil
+}
+
+// prepareExpense loads the expense's group, checks that the signed-in user may add expenses
+// to it, fills in the expense currency and derived split, validates the result and records
+// the exchange rate into the group currency. With applyDefaults set, an expense sent
+// without a split is split the group's default way. When anything is wrong it writes the
+// error response and returns false.
+func prepareExpense(w http.ResponseWriter, groupCollection *mongo.Collection, rates fx.RateProvider, userID primitive.ObjectID, expense *models.Expense, applyDefaults bool) bool {
+	if expense.GroupID == primitive.NilObjectID {
+		writeValidationErrors(w, validation.Errors{{Field: "GroupID", Message: "is required"}})
+		return false
+	}
+	group, err := findGroup(groupCollection, expense.GroupID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			writeValidationErrors(w, validation.Errors{{Field: "GroupID", Message: "group does not exist"}})
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+	if authz.CanAddExpense(group, userID) != nil {
+		writeForbidden(w)
+		return false
+	}
+
+	// Amounts sent without a currency are in the group's default expense currency
+	expense.Amount = expense.Amount.WithCurrency(group.ExpenseCurrency())
+	if applyDefaults {
+		applyGroupDefaults(expense, group)
+	}
+	normalizeAmounts(expense)
+	if err := applySplitMode(expense); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if errs := validation.ValidateExpense(*expense, group); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+
+	rate, err := exchangeRate(rates, expense.Amount.Currency, group.Currency)
+	if err != nil {
+		writeValidationErrors(w, validation.Errors{{Field: "Amount", Message: err.Error()}})
+		return false
+	}
+	expense.ExchangeRate = rate
+	return true
+}
+
+// exchangeRate looks up the current rate between two currencies.
+// It returns 0 when either currency is unknown, as no conversion can be made.
+func exchangeRate(rates fx.RateProvider, from, to string) (float64, error) {
+	if from == "" || to == "" {
+		return 0, nil
+	}
+	return rates.Rate(from, to, time.Now())
+}
+
+// writeValidationErrors responds with 422 Unprocessable Entity and the field-level errors.
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Errors validation.Errors `json:"errors"`
+	}{Errors: errs})
+}
+
+// findGroupExpenses loads every expense that belongs to the given group.
+func findGroupExpenses(collection *mongo.Collection, groupID primitive.ObjectID) ([]models.Expense, error) {
+	cursor, err := collection.Find(context.TODO(), bson.M{"groupId": groupID})
+	if err != nil {
+		return nil, err
+	}
 	defer cursor.Close(context.TODO())
 
 	// Iterate over the cursor and decode each document
 	var expenses []models.Expense
 	for cursor.Next(context.TODO()) {
 		var expense models.Expense
-		err := cursor.Decode(&expense)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := cursor.Decode(&expense); err != nil {
+			return nil, err
 		}
 		expenses = append(expenses, expense)
 	}
 
 	// Check for any errors encountered during iteration
 	if err := cursor.Err(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
-	// Respond with the list of expenses
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(expenses)
+	return expenses, nil
 }
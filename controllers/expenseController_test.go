@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"testing"
+)
+
+// applyUpdate applies the $set and $unset of an update to a stored expense the way Mongo
+// does, and reads the result back.
+func applyUpdate(t *testing.T, stored models.Expense, update bson.M) models.Expense {
+	t.Helper()
+	doc := toDocument(t, stored)
+	if set, ok := update["$set"]; ok {
+		for key, value := range toDocument(t, set) {
+			doc[key] = value
+		}
+	}
+	if unset, ok := update["$unset"].(bson.M); ok {
+		for key := range unset {
+			delete(doc, key)
+		}
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result models.Expense
+	if err := bson.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func toDocument(t *testing.T, value interface{}) bson.M {
+	t.Helper()
+	data, err := bson.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestExpenseUpdateClearsSplitMode(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	stored := models.Expense{
+		ID:           primitive.NewObjectID(),
+		PaidBy:       a,
+		Amount:       models.NewMoney(1000, "EUR"),
+		SplitMode:    "shares",
+		Participants: []models.SplitParticipant{{UserID: a, Value: 3}, {UserID: b, Value: 1}},
+		Split:        []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(750, "EUR")}, {UserID: b, Amount: models.NewMoney(250, "EUR")}},
+	}
+	updated := stored
+	updated.SplitMode = ""
+	updated.Participants = nil
+	updated.Split = []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(400, "EUR")}, {UserID: b, Amount: models.NewMoney(600, "EUR")}}
+
+	result := applyUpdate(t, stored, expenseUpdate(updated))
+	if result.SplitMode != "" || len(result.Participants) != 0 {
+		t.Fatalf("update kept split mode %q with participants %v", result.SplitMode, result.Participants)
+	}
+	if len(result.Split) != 2 || result.Split[0].Amount.Minor != 400 {
+		t.Fatalf("update stored split %v", result.Split)
+	}
+}
+
+func TestExpenseUpdateClearsItems(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	stored := models.Expense{
+		ID:        primitive.NewObjectID(),
+		PaidBy:    a,
+		Amount:    models.NewMoney(1320, "EUR"),
+		SplitMode: "itemized",
+		Items: []models.ExpenseItem{
+			{Name: "Pizza", Amount: models.NewMoney(1000, "EUR"), Participants: []primitive.ObjectID{a, b}},
+		},
+		Tax:   models.NewMoney(120, "EUR"),
+		Tip:   models.NewMoney(200, "EUR"),
+		Split: []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(660, "EUR")}, {UserID: b, Amount: models.NewMoney(660, "EUR")}},
+	}
+	updated := models.Expense{
+		ID:           stored.ID,
+		PaidBy:       a,
+		Amount:       models.NewMoney(1320, "EUR"),
+		SplitMode:    "equal",
+		Participants: []models.SplitParticipant{{UserID: a}, {UserID: b}},
+		Split:        stored.Split,
+	}
+
+	result := applyUpdate(t, stored, expenseUpdate(updated))
+	if len(result.Items) != 0 || !result.Tax.IsZero() || !result.Tip.IsZero() {
+		t.Fatalf("update kept items %v, tax %v and tip %v", result.Items, result.Tax, result.Tip)
+	}
+	if result.SplitMode != "equal" {
+		t.Fatalf("update stored split mode %q", result.SplitMode)
+	}
+}
+
+func TestExpenseUpdateToSinglePayer(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	split := []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(500, "EUR")}, {UserID: b, Amount: models.NewMoney(500, "EUR")}}
+	stored := models.Expense{
+		ID:     primitive.NewObjectID(),
+		PaidBy: a,
+		Payers: []models.Payer{
+			{UserID: a, Amount: models.NewMoney(600, "EUR")},
+			{UserID: b, Amount: models.NewMoney(400, "EUR")},
+		},
+		Amount: models.NewMoney(1000, "EUR"),
+		Split:  split,
+	}
+	updated := models.Expense{ID: stored.ID, PaidBy: b, Amount: models.NewMoney(1000, "EUR"), Split: split}
+
+	result := applyUpdate(t, stored, expenseUpdate(updated))
+	if len(result.Payers) != 0 {
+		t.Fatalf("update kept payers %v", result.Payers)
+	}
+	payments := result.Payments()
+	if len(payments) != 1 || payments[0].UserID != b || payments[0].Amount.Minor != 1000 {
+		t.Fatalf("Payments() = %v, want %s paying 1000", payments, b.Hex())
+	}
+}
+
+func TestExpenseUpdateClearsExchangeRate(t *testing.T) {
+	a := primitive.NewObjectID()
+	split := []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(1000, "EUR")}}
+	stored := models.Expense{PaidBy: a, Amount: models.NewMoney(1000, "USD"), ExchangeRate: 0.9, Split: split}
+	updated := models.Expense{PaidBy: a, Amount: models.NewMoney(1000, "EUR"), Split: split}
+
+	if result := applyUpdate(t, stored, expenseUpdate(updated)); result.ExchangeRate != 0 {
+		t.Fatalf("update kept exchange rate %v", result.ExchangeRate)
+	}
+}
+
+func TestExpenseUpdateClearsCategory(t *testing.T) {
+	a := primitive.NewObjectID()
+	split := []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(1000, "EUR")}}
+	stored := models.Expense{PaidBy: a, Amount: models.NewMoney(1000, "EUR"), Category: "Food", Split: split}
+	updated := models.Expense{PaidBy: a, Amount: models.NewMoney(1000, "EUR"), Split: split}
+
+	if result := applyUpdate(t, stored, expenseUpdate(updated)); result.Category != "" {
+		t.Fatalf("update kept category %q", result.Category)
+	}
+}
+
+func TestExpenseUpdateKeepsSplitMode(t *testing.T) {
+	a := primitive.NewObjectID()
+	expense := models.Expense{
+		PaidBy:       a,
+		Amount:       models.NewMoney(1000, "EUR"),
+		SplitMode:    "equal",
+		Participants: []models.SplitParticipant{{UserID: a}},
+		Split:        []models.ExpenseSplit{{UserID: a, Amount: models.NewMoney(1000, "EUR")}},
+	}
+	result := applyUpdate(t, models.Expense{}, expenseUpdate(expense))
+	if result.SplitMode != "equal" || len(result.Participants) != 1 {
+		t.Fatalf("update stored split mode %q with participants %v", result.SplitMode, result.Participants)
+	}
+}
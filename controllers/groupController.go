@@ -3,19 +3,31 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"mySplitBackEnd/authz"
+	"mySplitBackEnd/balance"
+	"mySplitBackEnd/membership"
 	"mySplitBackEnd/models"
+	"mySplitBackEnd/validation"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
-// CreateGroup handles the creation of a new group.
-func CreateGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection) {
+// CreateGroup handles the creation of a new group. People whose email or mobile number does
+// not belong to a registered user are invited, and join the group as placeholder members.
+func CreateGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection, inviter Inviter, defaultCurrency string) {
 	var request struct {
-		Name    string   `json:"name"`
-		Emails  []string `json:"emails"`
-		Creator string   `json:"creator"`
+		Name          string   `json:"name"`
+		Emails        []string `json:"emails"`
+		MobileNumbers []string `json:"mobileNumbers"`
+		Currency      string   `json:"currency"`
 	}
 
 	// Decode the request body
@@ -25,62 +37,671 @@ func CreateGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.C
 		return
 	}
 
-	// Check if creator is specified
-	if request.Creator == "" {
-		http.Error(w, "Creator must be specified", http.StatusBadRequest)
+	// The signed-in user creates the group
+	creatorID, ok := currentUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// Initialize group with unique members and add creator if not present
-	uniqueMembers := make(map[string]primitive.ObjectID)
-	for _, email := range request.Emails {
+	// Groups report balances in a single base currency
+	currency := strings.ToUpper(request.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	if !models.IsCurrency(currency) {
+		http.Error(w, "Currency must be an ISO 4217 currency code", http.StatusBadRequest)
+		return
+	}
+
+	// Initialize group with the creator followed by the other unique members
+	users := []primitive.ObjectID{creatorID}
+	uniqueMembers := map[primitive.ObjectID]bool{creatorID: true}
+	var invitees []models.User
+	addMember := func(field, value string) error {
 		var user models.User
-		if err := userCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user); err == nil {
-			uniqueMembers[email] = user.ID
+		err := userCollection.FindOne(context.TODO(), bson.M{field: value, "placeholder": bson.M{"$ne": true}}).Decode(&user)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			email, mobileNumber := "", ""
+			if field == "email" {
+				email = value
+			} else {
+				mobileNumber = value
+			}
+			user, err = membership.FindOrCreatePlaceholder(context.TODO(), userCollection, "", email, mobileNumber)
+		}
+		if err != nil {
+			return err
+		}
+		if !uniqueMembers[user.ID] {
+			uniqueMembers[user.ID] = true
+			users = append(users, user.ID)
+			if user.Placeholder {
+				invitees = append(invitees, user)
+			}
+		}
+		return nil
+	}
+	for _, email := range trimContacts(request.Emails) {
+		if err := addMember("email", email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, mobileNumber := range trimContacts(request.MobileNumbers) {
+		if err := addMember("mobileNumber", mobileNumber); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Create the group and add it to its members' groups
+	group := models.Group{
+		ID:       primitive.NewObjectID(),
+		Name:     request.Name,
+		Users:    users,
+		Creator:  creatorID,
+		Roles:    map[string]models.Role{creatorID.Hex(): models.RoleOwner},
+		Currency: currency,
+	}
+	err = membership.CreateGroup(context.TODO(), userCollection, groupCollection, group)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, invitee := range invitees {
+		if _, err := inviter.send(group, creatorID, invitee); err != nil {
+			log.Printf("Could not invite %s to group %s: %v", invitee.ID.Hex(), group.ID.Hex(), err)
 		}
 	}
 
-	// Check if creator is in the list of emails, add if not
-	creatorID, err := getCreatorID(userCollection, request.Creator)
+	// Respond with the created group
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(group)
 	if err != nil {
-		http.Error(w, "Invalid creator", http.StatusBadRequest)
 		return
 	}
-	uniqueMembers[request.Creator] = creatorID
+}
 
-	// Convert map keys to slice of ObjectIDs
-	users := make([]primitive.ObjectID, 0, len(uniqueMembers))
-	for _, id := range uniqueMembers {
-		users = append(users, id)
+// trimContacts trims the emails or mobile numbers of people to add to a group and drops
+// blank ones, which would otherwise match any user without that contact detail.
+func trimContacts(values []string) []string {
+	var contacts []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			contacts = append(contacts, value)
+		}
 	}
+	return contacts
+}
 
-	// Create and insert the group
-	group := models.Group{
-		ID:      primitive.NewObjectID(),
-		Name:    request.Name,
-		Users:   users,
-		Creator: creatorID,
+// GetMyGroups returns every group the signed-in user belongs to.
+func GetMyGroups(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
 	}
-	_, err = groupCollection.InsertOne(context.TODO(), group)
+
+	cursor, err := groupCollection.Find(context.TODO(), bson.M{"users": userID})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer cursor.Close(context.TODO())
+	groups := []models.Group{}
+	if err := cursor.All(context.TODO(), &groups); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Respond with the created group
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(group)
+	json.NewEncoder(w).Encode(groups)
+}
+
+// GetGroup returns a group along with the public profiles of its members.
+func GetGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	group, _, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+
+	cursor, err := userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": group.Users}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.TODO())
+	var users []models.User
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeGroup(w, group, users)
+}
+
+// groupMember is a member of a group as GetGroup lists them: their public profile and role.
+type groupMember struct {
+	models.PublicProfile
+	Role models.Role `json:"role"`
+}
+
+// writeGroup responds with a group and its members, each listed with their role, which
+// groups predating roles do not record.
+func writeGroup(w http.ResponseWriter, group models.Group, users []models.User) {
+	members := make([]groupMember, 0, len(users))
+	for _, user := range users {
+		members = append(members, groupMember{PublicProfile: user.PublicProfile(), Role: authz.RoleOf(group, user.ID)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Group   models.Group  `json:"group"`
+		Members []groupMember `json:"members"`
+	}{Group: group, Members: members})
+}
+
+// RenameGroup changes the name of a group.
+func RenameGroup(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Name string `json:"name"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanManageGroup(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	_, err = groupCollection.UpdateOne(context.TODO(), bson.M{"_id": groupID}, bson.M{"$set": bson.M{"name": request.Name}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	group.Name = request.Name
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// UpdateGroupSettings changes a group's settings. Only the settings present in the request
+// are changed; an empty value resets a setting to its default.
+func UpdateGroupSettings(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		DefaultCurrency     *string                    `json:"defaultCurrency"`
+		DefaultSplitMode    *string                    `json:"defaultSplitMode"`
+		DefaultParticipants *[]models.SplitParticipant `json:"defaultParticipants"`
+		SimplifyDebts       *bool                      `json:"simplifyDebts"`
+		Categories          *[]string                  `json:"categories"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanManageGroup(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	settings := group.Settings
+	if request.DefaultCurrency != nil {
+		settings.DefaultCurrency = strings.ToUpper(strings.TrimSpace(*request.DefaultCurrency))
+	}
+	if request.DefaultSplitMode != nil {
+		settings.DefaultSplitMode = *request.DefaultSplitMode
+	}
+	if request.DefaultParticipants != nil {
+		settings.DefaultParticipants = *request.DefaultParticipants
+	}
+	if request.SimplifyDebts != nil {
+		settings.SimplifyDebts = request.SimplifyDebts
+	}
+	if request.Categories != nil {
+		settings.Categories = nil
+		seen := make(map[string]bool)
+		for _, category := range *request.Categories {
+			category = strings.TrimSpace(category)
+			if category != "" && !seen[category] {
+				seen[category] = true
+				settings.Categories = append(settings.Categories, category)
+			}
+		}
+	}
+	if errs := validation.ValidateGroupSettings(settings, group); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	_, err = groupCollection.UpdateOne(context.TODO(), bson.M{"_id": groupID}, bson.M{"$set": bson.M{"settings": settings}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	group.Settings = settings
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// DeleteGroup lets the owner of a group delete it along with its expenses and settlements.
+// Groups whose balances are not settled cannot be deleted.
+func DeleteGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanDeleteGroup(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	balances, err := groupBalances(expenseCollection, settlementCollection, group)
+	if err != nil {
+		writeBalanceError(w, err)
+		return
+	}
+	for _, b := range balances {
+		if !b.Net.IsZero() {
+			http.Error(w, "Settle every balance before deleting the group", http.StatusConflict)
+			return
+		}
+	}
+
+	err = membership.DeleteGroup(context.TODO(), userCollection, groupCollection, expenseCollection, settlementCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddGroupMember adds a registered user, given by ID or email, to a group. Someone added by
+// an email nobody signed up with is invited as a placeholder member instead, and either way
+// the response is 202 Accepted without a body, so that it does not tell which emails are
+// registered.
+func AddGroupMember(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection, inviter Inviter) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		UserID primitive.ObjectID `json:"userId"`
+		Email  string             `json:"email"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	filter := bson.M{"_id": request.UserID}
+	byEmail := request.UserID.IsZero()
+	if byEmail {
+		if request.Email == "" {
+			http.Error(w, "Either userId or email is required", http.StatusBadRequest)
+			return
+		}
+		filter = bson.M{"email": request.Email, "placeholder": bson.M{"$ne": true}}
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanAddMember(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	var member models.User
+	err = userCollection.FindOne(context.TODO(), filter).Decode(&member)
+	if byEmail && errors.Is(err, mongo.ErrNoDocuments) {
+		// Invitees already in the group are sent a new invitation
+		_, _, err = inviter.invite(userCollection, groupCollection, group, userID, "", request.Email, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if authz.IsMember(group, member.ID) && !byEmail {
+		http.Error(w, "User is already a member of the group", http.StatusConflict)
+		return
+	}
+
+	if !authz.IsMember(group, member.ID) {
+		err = membership.AddMembers(context.TODO(), userCollection, groupCollection, groupID, []primitive.ObjectID{member.ID})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if byEmail {
+		w.WriteHeader(http.StatusAccepted)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member.PublicProfile())
 }
 
-// getCreatorID retrieves the ID of the creator by their email.
-func getCreatorID(collection *mongo.Collection, email string) (primitive.ObjectID, error) {
-	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+// RemoveGroupMember removes a member from a group, which is how members leave a group too.
+// Members who still owe or are owed money cannot be removed. When the owner leaves, the
+// group passes to the longest-standing admin, or else to the longest-standing member.
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	vars := mux.Vars(r)
+	groupID, err := primitive.ObjectIDFromHex(vars["groupId"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(vars["userId"])
 	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanRemoveMember(group, memberID, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+	if !authz.IsMember(group, memberID) {
+		http.Error(w, "User is not a member of the group", http.StatusNotFound)
+		return
+	}
+	successorID := primitive.NilObjectID
+	if authz.IsOwner(group, memberID) {
+		successorID, err = successorOf(userCollection, group, memberID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if successorID == primitive.NilObjectID {
+			http.Error(w, "Nobody else who signed up is left to own the group; delete the group instead", http.StatusConflict)
+			return
+		}
+	}
+
+	balances, err := groupBalances(expenseCollection, settlementCollection, group)
+	if err != nil {
+		writeBalanceError(w, err)
+		return
+	}
+	for _, b := range balances {
+		if b.UserID == memberID && !b.Net.IsZero() {
+			http.Error(w, "The member's balance must be settled before they leave the group", http.StatusConflict)
+			return
+		}
+	}
+
+	if successorID != primitive.NilObjectID {
+		err = membership.RemoveOwner(context.TODO(), userCollection, groupCollection, groupID, memberID, successorID)
+	} else {
+		err = membership.RemoveMember(context.TODO(), userCollection, groupCollection, groupID, memberID)
+	}
+	if err != nil {
+		if errors.Is(err, membership.ErrSuccessorLeft) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// successorOf picks who takes over a group from its owner: the admin who joined first, or
+// else the member or, failing that, the viewer who did. Placeholders cannot own a group.
+// It returns primitive.NilObjectID when there is nobody to pick.
+func successorOf(userCollection *mongo.Collection, group models.Group, ownerID primitive.ObjectID) (primitive.ObjectID, error) {
+	cursor, err := userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": group.Users}, "placeholder": true})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	var placeholders []models.User
+	if err := cursor.All(context.TODO(), &placeholders); err != nil {
 		return primitive.NilObjectID, err
 	}
-	return user.ID, nil
+	isPlaceholder := make(map[primitive.ObjectID]bool)
+	for _, placeholder := range placeholders {
+		isPlaceholder[placeholder.ID] = true
+	}
+
+	for _, role := range []models.Role{models.RoleAdmin, models.RoleMember, models.RoleViewer} {
+		for _, id := range group.Users {
+			if id != ownerID && !isPlaceholder[id] && authz.RoleOf(group, id) == role {
+				return id, nil
+			}
+		}
+	}
+	return primitive.NilObjectID, nil
+}
+
+// ChangeMemberRole gives a member of a group another role. Giving someone the owner role
+// transfers ownership of the group to them, and the previous owner becomes an admin.
+func ChangeMemberRole(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection) {
+	vars := mux.Vars(r)
+	groupID, err := primitive.ObjectIDFromHex(vars["groupId"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := primitive.ObjectIDFromHex(vars["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Role models.Role `json:"role"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !request.Role.Valid() {
+		http.Error(w, "Role must be one of owner, admin, member or viewer", http.StatusBadRequest)
+		return
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if !authz.IsMember(group, memberID) {
+		http.Error(w, "User is not a member of the group", http.StatusNotFound)
+		return
+	}
+	if authz.CanChangeRole(group, memberID, request.Role, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	update := bson.M{"roles." + memberID.Hex(): request.Role}
+	if request.Role == models.RoleOwner {
+		var member models.User
+		err = userCollection.FindOne(context.TODO(), bson.M{"_id": memberID}).Decode(&member)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if member.Placeholder {
+			http.Error(w, "Ownership can only be transferred to someone who signed up", http.StatusConflict)
+			return
+		}
+		update["roles."+userID.Hex()] = models.RoleAdmin
+	}
+
+	// The update only applies while the member is still in the group
+	result, err := groupCollection.UpdateOne(context.TODO(), bson.M{"_id": groupID, "users": memberID}, bson.M{"$set": update})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "User is not a member of the group", http.StatusNotFound)
+		return
+	}
+
+	group, err = findGroup(groupCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// groupBalances computes the net position of every member of a group in its currency.
+func groupBalances(expenseCollection *mongo.Collection, settlementCollection *mongo.Collection, group models.Group) ([]balance.Balance, error) {
+	expenses, err := findGroupExpenses(expenseCollection, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	settlements, err := findGroupSettlements(settlementCollection, group.ID)
+	if err != nil {
+		return nil, err
+	}
+	return balance.Compute(group.Users, expenses, settlements, group.Currency)
+}
+
+// GetGroupHistory returns a group's expenses and settlements as a single timeline, newest first.
+func GetGroupHistory(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	if _, _, ok := loadGroupForMember(w, r, groupCollection, groupID); !ok {
+		return
+	}
+
+	expenses, err := findGroupExpenses(expenseCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	settlements, err := findGroupSettlements(settlementCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Each entry carries its type so clients can tell expenses and settlements apart
+	type historyEntry struct {
+		Type       string             `json:"type"`
+		Date       time.Time          `json:"date"`
+		Expense    *models.Expense    `json:"expense,omitempty"`
+		Settlement *models.Settlement `json:"settlement,omitempty"`
+	}
+	history := make([]historyEntry, 0, len(expenses)+len(settlements))
+	for i := range expenses {
+		history = append(history, historyEntry{Type: "expense", Date: expenses[i].CreatedAt, Expense: &expenses[i]})
+	}
+	for i := range settlements {
+		history = append(history, historyEntry{Type: "settlement", Date: settlements[i].CreatedAt, Settlement: &settlements[i]})
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Date.After(history[j].Date)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// findGroup loads a group by its ID.
+func findGroup(collection *mongo.Collection, groupID primitive.ObjectID) (models.Group, error) {
+	var group models.Group
+	err := collection.FindOne(context.TODO(), bson.M{"_id": groupID}).Decode(&group)
+	return group, err
+}
+
+// loadGroupForMember loads a group and checks that the signed-in user is one of its members.
+// It writes a 404 or 403 response and returns false when the group does not exist or the
+// user may not access it.
+func loadGroupForMember(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, groupID primitive.ObjectID) (models.Group, primitive.ObjectID, bool) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return models.Group{}, userID, false
+	}
+
+	group, err := findGroup(groupCollection, groupID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return group, userID, false
+	}
+	if authz.CanView(group, userID) != nil {
+		writeForbidden(w)
+		return group, userID, false
+	}
+	return group, userID, true
+}
+
+// writeForbidden responds with 403 Forbidden.
+func writeForbidden(w http.ResponseWriter) {
+	http.Error(w, "You are not allowed to perform this operation in this group", http.StatusForbidden)
 }
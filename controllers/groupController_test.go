@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTrimContacts(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "blank entries are dropped", values: []string{"", " "}, want: nil},
+		{name: "entries are trimmed", values: []string{" ana@example.com ", "\t+15550100\n"}, want: []string{"ana@example.com", "+15550100"}},
+		{name: "blanks between entries", values: []string{"ana@example.com", "  ", "ben@example.com"}, want: []string{"ana@example.com", "ben@example.com"}},
+		{name: "no entries", values: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimContacts(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("trimContacts(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGroup(t *testing.T) {
+	owner, viewer := primitive.NewObjectID(), primitive.NewObjectID()
+	group := models.Group{
+		ID:      primitive.NewObjectID(),
+		Name:    "Trip",
+		Users:   []primitive.ObjectID{owner, viewer},
+		Creator: owner,
+		Roles:   map[string]models.Role{owner.Hex(): models.RoleOwner, viewer.Hex(): models.RoleViewer},
+	}
+	users := []models.User{
+		{ID: owner, Name: "Ana", Email: "ana@example.com", Password: "hash"},
+		{ID: viewer, Name: "Ben", Placeholder: true},
+	}
+
+	w := httptest.NewRecorder()
+	writeGroup(w, group, users)
+
+	var response struct {
+		Group   map[string]interface{}   `json:"group"`
+		Members []map[string]interface{} `json:"members"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("response is not JSON: %v\n%s", err, w.Body)
+	}
+	if len(response.Members) != 2 {
+		t.Fatalf("response has %d members, want 2:\n%s", len(response.Members), w.Body)
+	}
+	want := []map[string]interface{}{
+		{"ID": owner.Hex(), "Name": "Ana", "Email": "ana@example.com", "Placeholder": false, "role": "owner"},
+		{"ID": viewer.Hex(), "Name": "Ben", "Email": "", "Placeholder": true, "role": "viewer"},
+	}
+	for i, member := range response.Members {
+		if !reflect.DeepEqual(member, want[i]) {
+			t.Errorf("member %d = %v, want %v", i, member, want[i])
+		}
+	}
+	if response.Group["ID"] != group.ID.Hex() {
+		t.Errorf("group = %v, want the group with ID %s", response.Group, group.ID.Hex())
+	}
+}
@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/authz"
+	"mySplitBackEnd/mail"
+	"mySplitBackEnd/membership"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/sms"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const invitationTTL = 30 * 24 * time.Hour
+
+// Inviter sends invitations to people who have not signed up yet.
+type Inviter struct {
+	Invitations *mongo.Collection
+	Mailer      mail.Mailer
+	SMS         sms.SMSSender // Sends invitations to mobile numbers; they are not sent when nil
+	PublicURL   string
+}
+
+// InviteToGroup invites someone who has not signed up yet to a group by email or mobile
+// number. They join the group straight away as a placeholder member who can be part of
+// expenses, and take their place once they accept the invitation or sign up and prove they
+// own the email or number.
+func InviteToGroup(w http.ResponseWriter, r *http.Request, userCollection *mongo.Collection, groupCollection *mongo.Collection, inviter Inviter) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	var request struct {
+		Name         string `json:"name"`
+		Email        string `json:"email"`
+		MobileNumber string `json:"mobileNumber"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Email = strings.TrimSpace(request.Email)
+	request.MobileNumber = strings.TrimSpace(request.MobileNumber)
+	if request.Email == "" && request.MobileNumber == "" {
+		http.Error(w, "Either email or mobileNumber is required", http.StatusBadRequest)
+		return
+	}
+
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanAddMember(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	// People who already signed up are added as members instead
+	exists, err := userExists(userCollection, request.Email, request.MobileNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "This person already has an account; add them as a member instead", http.StatusConflict)
+		return
+	}
+
+	placeholder, token, err := inviter.invite(userCollection, groupCollection, group, userID, request.Name, request.Email, request.MobileNumber)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Member    models.PublicProfile `json:"member"`
+		InviteURL string               `json:"inviteUrl"`
+		ExpiresAt time.Time            `json:"expiresAt"`
+	}{
+		Member:    placeholder.PublicProfile(),
+		InviteURL: link(inviter.PublicURL, "/invite", token),
+		ExpiresAt: time.Now().Add(invitationTTL),
+	})
+}
+
+// AcceptInvitation adds the signed-in user to the group of an invitation, taking over
+// everything the invitee's placeholder took part in. Invitations to deleted groups, or whose
+// placeholder is no longer a member of the group, are refused with 410 Gone.
+func AcceptInvitation(w http.ResponseWriter, r *http.Request, memberships membership.Collections, invitationCollection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Token string `json:"token"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = memberships.Users.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invitation, err := auth.AcceptInvitation(context.TODO(), invitationCollection, request.Token, user)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidInvitation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Invitations lapse once their placeholder leaves the group, or was merged into whoever
+	// proved they own the email or number the invitation went to
+	err = membership.AcceptInvitation(context.TODO(), memberships, invitation.GroupID, invitation.UserID, user.ID)
+	if err != nil {
+		if errors.Is(err, membership.ErrInvitationWithdrawn) {
+			http.Error(w, err.Error(), http.StatusGone)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	group, err := findGroup(memberships.Groups, invitation.GroupID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Group not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(group)
+}
+
+// invite adds the placeholder for an invitee to a group, creating it if needed, and sends
+// them an invitation. It returns the placeholder and the token of the invitation link.
+func (inviter Inviter) invite(userCollection *mongo.Collection, groupCollection *mongo.Collection, group models.Group, invitedBy primitive.ObjectID, name, email, mobileNumber string) (models.User, string, error) {
+	placeholder, err := membership.FindOrCreatePlaceholder(context.TODO(), userCollection, name, email, mobileNumber)
+	if err != nil {
+		return placeholder, "", err
+	}
+	if !authz.IsMember(group, placeholder.ID) {
+		err = membership.AddMembers(context.TODO(), userCollection, groupCollection, group.ID, []primitive.ObjectID{placeholder.ID})
+		if err != nil {
+			return placeholder, "", err
+		}
+	}
+	token, err := inviter.send(group, invitedBy, placeholder)
+	return placeholder, token, err
+}
+
+// send records an invitation for a placeholder member of a group and sends its link to
+// the placeholder's email or mobile number. A failure to deliver it is only logged, as the
+// link is also handed to the member who invited them, and so is not sending it at all when
+// there is no way to send text messages.
+func (inviter Inviter) send(group models.Group, invitedBy primitive.ObjectID, placeholder models.User) (string, error) {
+	now := time.Now()
+	token, err := auth.IssueInvitation(context.TODO(), inviter.Invitations, models.Invitation{
+		ID:           primitive.NewObjectID(),
+		GroupID:      group.ID,
+		UserID:       placeholder.ID,
+		InvitedBy:    invitedBy,
+		Email:        placeholder.Email,
+		MobileNumber: placeholder.MobileNumber,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(invitationTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	inviteURL := link(inviter.PublicURL, "/invite", token)
+	if placeholder.Email != "" {
+		err = inviter.Mailer.Send(context.TODO(), mail.Message{
+			To:      placeholder.Email,
+			Subject: "You have been invited to " + group.Name + " on mySplit",
+			Body: "You have been added to the group " + group.Name + " on mySplit to share expenses.\n\n" +
+				"Join it at:\n" + inviteURL + "\n",
+		})
+	} else if inviter.SMS != nil {
+		err = inviter.SMS.Send(context.TODO(), placeholder.MobileNumber, "You have been added to "+group.Name+" on mySplit. Join it at "+inviteURL)
+	}
+	if err != nil {
+		log.Printf("Could not send invitation to %s: %v", placeholder.ID.Hex(), err)
+	}
+	return token, nil
+}
+
+// claimPlaceholders merges the placeholders of a user's verified email or mobile number
+// into them. Failures are only logged, as the user can still accept their invitations.
+func claimPlaceholders(memberships membership.Collections, userID primitive.ObjectID, matchEmail, matchMobile bool) {
+	var user models.User
+	err := memberships.Users.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err == nil {
+		err = membership.ClaimPlaceholders(context.TODO(), memberships, user, matchEmail, matchMobile)
+	}
+	if err != nil {
+		log.Printf("Could not merge the invitations of user %s: %v", userID.Hex(), err)
+	}
+}
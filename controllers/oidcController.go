@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/membership"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/oidc"
+	"net/http"
+	"time"
+)
+
+// BeginOIDCLogin redirects the user to the provider named in the URL to sign in.
+// secureCookies is set when the server is reached over HTTPS.
+func BeginOIDCLogin(w http.ResponseWriter, r *http.Request, oidcLoginCollection *mongo.Collection, providers map[string]*oidc.Provider, secureCookies bool) {
+	provider, ok := providers[mux.Vars(r)["provider"]]
+	if !ok {
+		http.Error(w, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+
+	authURL, browserKey, err := provider.BeginLogin(context.TODO(), oidcLoginCollection)
+	if err != nil {
+		log.Printf("Could not start sign-in with %s: %v", mux.Vars(r)["provider"], err)
+		http.Error(w, "The sign-in provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	http.SetCookie(w, oidcLoginCookie(browserKey, 0, secureCookies))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcLoginCookie returns the cookie that ties a sign-in to the browser that started it.
+// Providers using response_mode=form_post post back from their own site, and browsers only
+// send SameSite=None cookies along with such a post, which in turn must be Secure. Over
+// plain HTTP, in development, browsers refuse those, so the cookie is Lax instead and only
+// comes along when the web app posts the code back from the same site.
+func oidcLoginCookie(value string, maxAge int, secure bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oidcLoginCookieName,
+		Value:    value,
+		Path:     "/api/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if secure {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
+
+const oidcLoginCookieName = "oidc_login"
+
+// oidcBrowserKey returns the key in the cookie set by BeginOIDCLogin, or "" without one.
+func oidcBrowserKey(r *http.Request) string {
+	cookie, err := r.Cookie(oidcLoginCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// FinishOIDCLogin signs a user in with the code and state the provider sent back to the
+// web app, responding like SignIn. The provider's account is linked to the user who already
+// has it linked, otherwise to the user with the same email if both the user and the
+// provider verified it, and otherwise to a new user.
+func FinishOIDCLogin(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, userTokenCollection *mongo.Collection, oidcLoginCollection *mongo.Collection, providers map[string]*oidc.Provider, tokens *auth.Tokens, memberships membership.Collections, secureCookies bool) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := providers[providerName]
+	if !ok {
+		http.Error(w, "Unknown sign-in provider", http.StatusNotFound)
+		return
+	}
+
+	var request struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	browserKey := oidcBrowserKey(r)
+	http.SetCookie(w, oidcLoginCookie("", -1, secureCookies))
+
+	claims, err := provider.FinishLogin(context.TODO(), oidcLoginCollection, request.Code, request.State, browserKey)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidState) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			log.Printf("Could not finish sign-in with %s: %v", providerName, err)
+			http.Error(w, "Sign-in with the provider failed", http.StatusUnauthorized)
+		}
+		return
+	}
+
+	user, err := findOrLinkIdentity(collection, providerName, claims)
+	if err != nil {
+		if errors.Is(err, errIdentityConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	// Providers cannot be used to get around a lockout after too many wrong passwords
+	if wait := auth.LockedFor(user); wait > 0 {
+		writeLocked(w, wait)
+		return
+	}
+	// Only the email the provider vouches for proves who the invitations were meant for
+	if claims.EmailVerified && claims.Email == user.Email {
+		claimPlaceholders(memberships, user.ID, true, false)
+	}
+
+	completeSignIn(w, r, collection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, tokens, user)
+}
+
+// errIdentityConflict is returned when a provider's account has the email of an existing
+// user but either side has not verified it, so it cannot be trusted to link the two.
+var errIdentityConflict = errors.New("an account with this email already exists; sign in with your password and verify your email first")
+
+// canLinkByEmail reports whether a provider's account may be linked to the existing user
+// with the same email. Both must have verified it: otherwise whoever signed up with
+// someone else's email would keep a password to the account its owner signs in to.
+func canLinkByEmail(user models.User, claims oidc.Claims) bool {
+	return claims.EmailVerified && user.EmailVerified && claims.Email == user.Email
+}
+
+// findOrLinkIdentity returns the user a provider's account belongs to, linking it to the
+// user with the same verified email or creating a new user when no user has it yet.
+func findOrLinkIdentity(collection *mongo.Collection, providerName string, claims oidc.Claims) (models.User, error) {
+	var user models.User
+	err := collection.FindOne(context.TODO(), bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": providerName, "subject": claims.Subject}},
+	}).Decode(&user)
+	if err == nil || !errors.Is(err, mongo.ErrNoDocuments) {
+		return user, err
+	}
+
+	identity := models.Identity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now(),
+	}
+	if claims.Email != "" {
+		err = collection.FindOne(context.TODO(), bson.M{"email": claims.Email, "placeholder": bson.M{"$ne": true}}).Decode(&user)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return user, err
+		}
+		if err == nil {
+			if !canLinkByEmail(user, claims) {
+				return user, errIdentityConflict
+			}
+			_, err = collection.UpdateOne(context.TODO(),
+				bson.M{"_id": user.ID},
+				bson.M{"$push": bson.M{"identities": identity}})
+			user.Identities = append(user.Identities, identity)
+			return user, err
+		}
+	}
+
+	user = models.User{
+		ID:            primitive.NewObjectID(),
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified && claims.Email != "",
+		Groups:        []primitive.ObjectID{},
+		Identities:    []models.Identity{identity},
+	}
+	_, err = collection.InsertOne(context.TODO(), user)
+	return user, err
+}
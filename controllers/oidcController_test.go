@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/oidc"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanLinkByEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   models.User
+		claims oidc.Claims
+		want   bool
+	}{
+		{
+			name:   "both verified",
+			user:   models.User{Email: "ana@example.com", EmailVerified: true},
+			claims: oidc.Claims{Email: "ana@example.com", EmailVerified: true},
+			want:   true,
+		},
+		{
+			// Someone signed up with the email and a password but never proved they own it
+			name:   "account email not verified",
+			user:   models.User{Email: "ana@example.com", Password: "hash"},
+			claims: oidc.Claims{Email: "ana@example.com", EmailVerified: true},
+			want:   false,
+		},
+		{
+			name:   "provider email not verified",
+			user:   models.User{Email: "ana@example.com", EmailVerified: true},
+			claims: oidc.Claims{Email: "ana@example.com"},
+			want:   false,
+		},
+		{
+			name:   "different emails",
+			user:   models.User{Email: "ana@example.com", EmailVerified: true},
+			claims: oidc.Claims{Email: "ben@example.com", EmailVerified: true},
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canLinkByEmail(tt.user, tt.claims); got != tt.want {
+				t.Errorf("canLinkByEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// browserSends reports whether a browser that received the cookie over https, or over plain
+// HTTP, would send it along with a POST to path, made from another site when crossSite is set.
+func browserSends(cookie *http.Cookie, https, crossSite bool, path string) bool {
+	switch {
+	case cookie.Secure && !https:
+		return false // Secure cookies are not stored from or sent to plain HTTP
+	case cookie.SameSite == http.SameSiteNoneMode && !cookie.Secure:
+		return false // SameSite=None cookies are refused unless they are Secure
+	case !strings.HasPrefix(path, cookie.Path):
+		return false
+	case crossSite && cookie.SameSite != http.SameSiteNoneMode:
+		return false // Lax and Strict cookies stay behind on cross-site posts
+	}
+	return true
+}
+
+func TestOIDCLoginCookieReachesCallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		secure    bool
+		crossSite bool
+	}{
+		{name: "provider posts the code back over https", secure: true, crossSite: true},
+		{name: "web app posts the code back over https", secure: true},
+		{name: "web app posts the code back in development over http"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The cookie as the browser receives it when the sign-in starts
+			w := httptest.NewRecorder()
+			http.SetCookie(w, oidcLoginCookie("browser-key", 0, tt.secure))
+			cookies := (&http.Response{Header: w.Header()}).Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("got %d cookies, want 1", len(cookies))
+			}
+
+			path := "/api/oidc/google/callback"
+			if !browserSends(cookies[0], tt.secure, tt.crossSite, path) {
+				t.Fatalf("a browser would not send %q to the callback", w.Header().Get("Set-Cookie"))
+			}
+			// Browsers only send the name and value back
+			r := httptest.NewRequest(http.MethodPost, path, nil)
+			r.AddCookie(&http.Cookie{Name: cookies[0].Name, Value: cookies[0].Value})
+			if got := oidcBrowserKey(r); got != "browser-key" {
+				t.Errorf("oidcBrowserKey() = %q, want %q", got, "browser-key")
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/membership"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/sms"
+	"net/http"
+)
+
+// RequestOTP texts a one-time sign-in code to the mobile number, if it belongs to a user.
+// It responds with 202 Accepted whether or not the number is registered, and with 429 Too
+// Many Requests when codes are requested for the number too often.
+func RequestOTP(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, otpCollection *mongo.Collection, tokens *auth.Tokens, sender sms.SMSSender) {
+	var request struct {
+		MobileNumber string `json:"mobileNumber"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.MobileNumber == "" {
+		http.Error(w, "MobileNumber is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"mobileNumber": request.MobileNumber, "placeholder": bson.M{"$ne": true}}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	code, err := tokens.IssueOTP(context.TODO(), otpCollection, request.MobileNumber, user.ID)
+	if err != nil {
+		if errors.Is(err, auth.ErrOTPRateLimited) {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Codes for unregistered numbers are recorded but never sent
+	if !user.ID.IsZero() {
+		err = sender.Send(context.TODO(), user.MobileNumber, "Your mySplit sign-in code is "+code+". It expires in 5 minutes.")
+		if err != nil {
+			log.Printf("Could not send sign-in code to %s: %v", user.MobileNumber, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyOTP signs a user in with a code sent by RequestOTP, responding like SignIn.
+func VerifyOTP(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, userTokenCollection *mongo.Collection, otpCollection *mongo.Collection, tokens *auth.Tokens, memberships membership.Collections) {
+	var request struct {
+		MobileNumber string `json:"mobileNumber"`
+		Code         string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"mobileNumber": request.MobileNumber, "placeholder": bson.M{"$ne": true}}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Codes cannot be used to get around a lockout after too many wrong passwords
+	if wait := auth.LockedFor(user); wait > 0 {
+		writeLocked(w, wait)
+		return
+	}
+
+	otp, err := tokens.VerifyOTP(context.TODO(), otpCollection, request.MobileNumber, request.Code)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidOTP) || errors.Is(err, auth.ErrOTPAttemptsExceeded) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	// The number may have changed hands since the code was issued
+	if user.ID.IsZero() || otp.UserID != user.ID {
+		http.Error(w, auth.ErrInvalidOTP.Error(), http.StatusUnauthorized)
+		return
+	}
+	claimPlaceholders(memberships, user.ID, false, true)
+
+	completeSignIn(w, r, collection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, tokens, user)
+}
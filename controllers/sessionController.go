@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/auth"
+	"net/http"
+	"time"
+)
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token can only be used once; using it again signs out its whole session.
+func RefreshToken(w http.ResponseWriter, r *http.Request, sessionCollection *mongo.Collection, tokens *auth.Tokens) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.RefreshToken == "" {
+		http.Error(w, "refreshToken is required", http.StatusBadRequest)
+		return
+	}
+
+	refreshToken, session, err := tokens.RotateSession(context.TODO(), sessionCollection, request.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	tokenString, expiresAt, err := tokens.IssueAccessToken(session.UserID, session.FamilyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Token        string    `json:"token"`
+		ExpiresAt    time.Time `json:"expiresAt"`
+		RefreshToken string    `json:"refreshToken"`
+	}{
+		Token:        tokenString,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Logout signs out the session the request was made with.
+func Logout(w http.ResponseWriter, r *http.Request, sessionCollection *mongo.Collection) {
+	sessionID, ok := auth.SessionID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := auth.RevokeFamily(context.TODO(), sessionCollection, sessionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll signs the user out on every device.
+func LogoutAll(w http.ResponseWriter, r *http.Request, sessionCollection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := auth.RevokeAll(context.TODO(), sessionCollection, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetJWKS publishes the public keys access tokens are signed with, so that other services
+// can verify them without sharing a secret.
+func GetJWKS(w http.ResponseWriter, r *http.Request, tokens *auth.Tokens) {
+	response := struct {
+		Keys []auth.JWK `json:"keys"`
+	}{
+		Keys: tokens.JWKS(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(response)
+}
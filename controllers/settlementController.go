@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/authz"
+	"mySplitBackEnd/fx"
+	"mySplitBackEnd/models"
+	"net/http"
+	"time"
+)
+
+// CreateSettlement records a payment from one group member to another.
+func CreateSettlement(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, settlementCollection *mongo.Collection, rates fx.RateProvider) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var settlement models.Settlement
+	err = json.NewDecoder(r.Body).Decode(&settlement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if settlement.Amount.Minor <= 0 {
+		http.Error(w, "Amount must be greater than zero", http.StatusBadRequest)
+		return
+	}
+	if settlement.PaidBy == settlement.PaidTo {
+		http.Error(w, "PaidBy and PaidTo must be different users", http.StatusBadRequest)
+		return
+	}
+
+	// The signed-in user is recorded as the creator and must belong to the group
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanAddExpense(group, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+	settlement.CreatedBy = userID
+	if !authz.IsMember(group, settlement.PaidBy) || !authz.IsMember(group, settlement.PaidTo) {
+		http.Error(w, "PaidBy and PaidTo must be members of the group", http.StatusBadRequest)
+		return
+	}
+
+	// Amounts sent without a currency are in the group's currency
+	settlement.Amount = settlement.Amount.WithCurrency(group.Currency)
+	settlement.ExchangeRate, err = exchangeRate(rates, settlement.Amount.Currency, group.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Set the ID, group and timestamp
+	settlement.ID = primitive.NewObjectID()
+	settlement.GroupID = groupID
+	settlement.CreatedAt = time.Now()
+	_, err = settlementCollection.InsertOne(context.TODO(), settlement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(settlement)
+}
+
+// GetSettlementsByGroup retrieves all settlements recorded in a group.
+func GetSettlementsByGroup(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	groupIDParam := mux.Vars(r)["groupId"]
+	groupID, err := primitive.ObjectIDFromHex(groupIDParam)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	if _, _, ok := loadGroupForMember(w, r, groupCollection, groupID); !ok {
+		return
+	}
+
+	settlements, err := findGroupSettlements(settlementCollection, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlements)
+}
+
+// DeleteSettlement deletes a settlement from a group.
+func DeleteSettlement(w http.ResponseWriter, r *http.Request, groupCollection *mongo.Collection, settlementCollection *mongo.Collection) {
+	vars := mux.Vars(r)
+	groupID, err := primitive.ObjectIDFromHex(vars["groupId"])
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var settlement models.Settlement
+	err = settlementCollection.FindOne(context.TODO(), bson.M{"_id": id, "groupId": groupID}).Decode(&settlement)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Settlement not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Only the member who recorded the settlement or a group admin may delete it
+	group, userID, ok := loadGroupForMember(w, r, groupCollection, groupID)
+	if !ok {
+		return
+	}
+	if authz.CanModifySettlement(group, settlement, userID) != nil {
+		writeForbidden(w)
+		return
+	}
+
+	_, err = settlementCollection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findGroupSettlements loads every settlement that belongs to the given group.
+func findGroupSettlements(collection *mongo.Collection, groupID primitive.ObjectID) ([]models.Settlement, error) {
+	cursor, err := collection.Find(context.TODO(), bson.M{"groupId": groupID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var settlements []models.Settlement
+	if err := cursor.All(context.TODO(), &settlements); err != nil {
+		return nil, err
+	}
+	return settlements, nil
+}
@@ -0,0 +1,330 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/totp"
+	"net/http"
+	"time"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	totpIssuer            = "mySplit"
+	// recentSignInWindow is how soon after signing in users without a password can turn
+	// two-factor authentication off
+	recentSignInWindow = 5 * time.Minute
+)
+
+// errSignInRequired is returned when a user without a password turns two-factor
+// authentication off in a session that did not just start.
+var errSignInRequired = errors.New("sign in again to turn off two-factor authentication")
+
+// writeTwoFactorChallenge responds to a sign-in of a user with two-factor authentication
+// with a token to send back to SignInTwoFactor along with a code.
+func writeTwoFactorChallenge(w http.ResponseWriter, userTokenCollection *mongo.Collection, user models.User) {
+	token, err := auth.IssueUserToken(context.TODO(), userTokenCollection, user, models.TokenPurposeTwoFactor, twoFactorChallengeTTL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		TwoFactorRequired bool      `json:"twoFactorRequired"`
+		TwoFactorToken    string    `json:"twoFactorToken"`
+		ExpiresAt         time.Time `json:"expiresAt"`
+	}{
+		TwoFactorRequired: true,
+		TwoFactorToken:    token,
+		ExpiresAt:         time.Now().Add(twoFactorChallengeTTL),
+	})
+}
+
+// SignInTwoFactor finishes signing in a user with two-factor authentication using the
+// challenge token from the first step and a code from their authenticator app or one of
+// their recovery codes. It responds like SignIn. Wrong codes count towards the lockout of
+// the account like wrong passwords.
+func SignInTwoFactor(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, userTokenCollection *mongo.Collection, tokens *auth.Tokens) {
+	var request struct {
+		TwoFactorToken string `json:"twoFactorToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The challenge is only used up once the code is right, so a typo does not restart sign-in
+	challenge, err := auth.FindUserToken(context.TODO(), userTokenCollection, request.TwoFactorToken, models.TokenPurposeTwoFactor)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"_id": challenge.UserID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if wait := auth.LockedFor(user); wait > 0 {
+		writeLocked(w, wait)
+		return
+	}
+
+	err = auth.VerifySecondFactor(context.TODO(), collection, user, request.Code, request.RecoveryCode)
+	if errors.Is(err, auth.ErrInvalidSecondFactor) {
+		wait, err := auth.RecordFailedLogin(context.TODO(), collection, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeLocked(w, wait)
+			return
+		}
+		http.Error(w, auth.ErrInvalidSecondFactor.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = auth.ConsumeUserToken(context.TODO(), userTokenCollection, request.TwoFactorToken, models.TokenPurposeTwoFactor)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidUserToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if user.FailedLogins > 0 {
+		err = auth.ResetFailedLogins(context.TODO(), collection, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	respondSignedIn(w, r, collection, groupCollection, expenseCollection, sessionCollection, tokens, user)
+}
+
+// EnrollTwoFactor starts enabling two-factor authentication for the signed-in user. It
+// responds with the secret to add to an authenticator app, also as an otpauth:// URI for a
+// QR code. Two-factor authentication is enabled once ConfirmTwoFactor receives a code.
+func EnrollTwoFactor(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var user models.User
+	err := collection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userID, "totpEnabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"totpSecret": secret}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.MobileNumber
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauthUri"`
+	}{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer, account, secret),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication for the signed-in user once they send
+// a code from the authenticator app set up by EnrollTwoFactor. It responds with recovery
+// codes, which are shown only this once.
+func ConfirmTwoFactor(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Code string `json:"code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Start enrolment first", http.StatusBadRequest)
+		return
+	}
+	counter, ok := totp.Validate(user.TOTPSecret, request.Code, time.Now())
+	if !ok {
+		http.Error(w, auth.ErrInvalidSecondFactor.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result, err := collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userID, "totpSecret": user.TOTPSecret, "totpEnabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"totpEnabled": true, "totpLastCounter": counter, "recoveryCodes": hashes}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Enrolment was restarted or already confirmed", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off for the signed-in user, who must
+// confirm it with their password and a code from their authenticator app or a recovery code.
+// Users without a password, who sign in with a provider or a text message, confirm it with
+// the code alone in a session that started moments ago.
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
+	userID, ok := currentUserID(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	err = collection.FindOne(context.TODO(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+	if wait := auth.LockedFor(user); wait > 0 {
+		writeLocked(w, wait)
+		return
+	}
+
+	sessionID, _ := auth.SessionID(r.Context())
+	err = checkReauthentication(user, sessionID, request.Password, time.Now())
+	if errors.Is(err, errSignInRequired) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err == nil {
+		err = auth.VerifySecondFactor(context.TODO(), collection, user, request.Code, request.RecoveryCode)
+	}
+	if errors.Is(err, auth.ErrInvalidSecondFactor) {
+		wait, err := auth.RecordFailedLogin(context.TODO(), collection, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeLocked(w, wait)
+			return
+		}
+		http.Error(w, "Invalid password or authentication code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = collection.UpdateOne(context.TODO(),
+		bson.M{"_id": userID},
+		bson.M{
+			"$set":   bson.M{"totpEnabled": false, "failedLogins": 0},
+			"$unset": bson.M{"totpSecret": "", "totpLastCounter": "", "recoveryCodes": ""},
+		})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkReauthentication checks that the user turning two-factor authentication off is not
+// just someone holding a stolen access token. Users with a password must enter it; users
+// without one must be in a session that started within recentSignInWindow, as signing in
+// took their second factor too.
+func checkReauthentication(user models.User, sessionID primitive.ObjectID, password string, now time.Time) error {
+	if user.Password == "" {
+		// Session families are named after their first session, so the ID holds the sign-in time
+		if now.Sub(sessionID.Timestamp()) > recentSignInWindow {
+			return errSignInRequired
+		}
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return auth.ErrInvalidSecondFactor
+	}
+	return nil
+}
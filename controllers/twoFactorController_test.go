@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/models"
+	"testing"
+	"time"
+)
+
+func TestCheckReauthentication(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPassword := models.User{Password: string(hash)}
+	passwordless := models.User{Identities: []models.Identity{{Provider: "google", Subject: "1"}}}
+	freshSession := primitive.NewObjectIDFromTimestamp(now.Add(-time.Minute))
+	staleSession := primitive.NewObjectIDFromTimestamp(now.Add(-time.Hour))
+
+	tests := []struct {
+		name      string
+		user      models.User
+		sessionID primitive.ObjectID
+		password  string
+		want      error
+	}{
+		{name: "right password", user: withPassword, sessionID: staleSession, password: "correct horse"},
+		{name: "wrong password", user: withPassword, sessionID: freshSession, password: "wrong", want: auth.ErrInvalidSecondFactor},
+		{name: "no password entered", user: withPassword, sessionID: freshSession, want: auth.ErrInvalidSecondFactor},
+		{name: "passwordless user who just signed in", user: passwordless, sessionID: freshSession},
+		{name: "passwordless user in an old session", user: passwordless, sessionID: staleSession, want: errSignInRequired},
+		{name: "passwordless user sending a password", user: passwordless, sessionID: staleSession, password: "anything", want: errSignInRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkReauthentication(tt.user, tt.sessionID, tt.password, now); !errors.Is(got, tt.want) {
+				t.Errorf("checkReauthentication() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
-	"mySplitBackEnd/config"
+	"log"
+	"math"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/mail"
 	"mySplitBackEnd/models"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -22,15 +25,37 @@ func ExampleAPIHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"message": "This is an example API endpoint from controllers"}`))
 }
 
-func CreateUser(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
-	var user models.User
+// CreateUser registers a new user and emails them a link to verify their email address.
+func CreateUser(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, userTokenCollection *mongo.Collection, mailer mail.Mailer, publicURL string, verificationTTL time.Duration) {
+	var request struct {
+		Name         string `json:"name"`
+		MobileNumber string `json:"mobileNumber"`
+		Email        string `json:"email"`
+		Password     string `json:"password"`
+	}
 
-	// Decode the request body into the user struct
-	err := json.NewDecoder(r.Body).Decode(&user)
+	// Decode the request body
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if request.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+	if len(request.Password) < minPasswordLength {
+		http.Error(w, passwordTooShortMessage, http.StatusBadRequest)
+		return
+	}
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Name:         request.Name,
+		MobileNumber: request.MobileNumber,
+		Email:        request.Email,
+		Groups:       []primitive.ObjectID{},
+		Password:     request.Password,
+	}
 	exists, err := userExists(collection, user.Email, user.MobileNumber)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -56,8 +81,15 @@ func CreateUser(w http.ResponseWriter, r *http.Request, collection *mongo.Collec
 		return
 	}
 
+	// A failed email does not undo the sign-up; the user can ask for a new one
+	err = sendVerificationEmail(userTokenCollection, mailer, publicURL, verificationTTL, user)
+	if err != nil {
+		log.Printf("Could not send verification email to %s: %v", user.Email, err)
+	}
+
 	// Respond with the created user
-	err = json.NewEncoder(w).Encode(user)
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(user.SelfProfile())
 	if err != nil {
 		return
 	}
@@ -65,11 +97,22 @@ func CreateUser(w http.ResponseWriter, r *http.Request, collection *mongo.Collec
 
 func userExists(collection *mongo.Collection, email, mobileNumber string) (bool, error) {
 	var result models.User
+	// A blank email or number would match every user who has none, such as those who
+	// signed in with a provider or a code
+	var contacts []bson.M
+	if email != "" {
+		contacts = append(contacts, bson.M{"email": email})
+	}
+	if mobileNumber != "" {
+		contacts = append(contacts, bson.M{"mobileNumber": mobileNumber})
+	}
+	if len(contacts) == 0 {
+		return false, nil
+	}
 	filter := bson.M{
-		"$or": []bson.M{
-			{"email": email},
-			{"mobileNumber": mobileNumber},
-		},
+		"$or": contacts,
+		// Invitees who have not signed up yet can still sign up with their email or number
+		"placeholder": bson.M{"$ne": true},
 	}
 	err := collection.FindOne(context.TODO(), filter).Decode(&result)
 
@@ -83,7 +126,8 @@ func userExists(collection *mongo.Collection, email, mobileNumber string) (bool,
 }
 
 // SignIn handles user authentication and returns a JWT.
-func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection) {
+// Users with two-factor authentication then answer a challenge at SignInTwoFactor.
+func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, userTokenCollection *mongo.Collection, tokens *auth.Tokens) {
 	var credentials struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -96,33 +140,84 @@ func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection
 		return
 	}
 
+	// Users who signed in with a provider that gave no email have none to sign in with
+	if credentials.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
 	// Find user by email
 	var user models.User
-	err = collection.FindOne(context.TODO(), bson.M{"email": credentials.Email}).Decode(&user)
+	err = collection.FindOne(context.TODO(), bson.M{"email": credentials.Email, "placeholder": bson.M{"$ne": true}}).Decode(&user)
 	if err != nil {
+		// Compare against a dummy hash so unknown emails take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(credentials.Password))
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
+	// Accounts are locked for a while after too many wrong passwords
+	if wait := auth.LockedFor(user); wait > 0 {
+		writeLocked(w, wait)
+		return
+	}
+
 	// Compare password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password))
 	if err != nil {
+		wait, err := auth.RecordFailedLogin(context.TODO(), collection, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeLocked(w, wait)
+			return
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-
-	// Create token
-	expirationTime := time.Now().Add(1 * time.Hour)
-	claims := &models.Claims{
-		UserID: user.ID,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// With two-factor authentication the count is only cleared once the code is right too
+	if user.FailedLogins > 0 && !user.TOTPEnabled {
+		err = auth.ResetFailedLogins(context.TODO(), collection, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(config.JwtKey) // jwtKey is your secret key
+	completeSignIn(w, r, collection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, tokens, user)
+}
+
+// dummyPasswordHash is compared against when signing in with an unknown email.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// writeLocked responds with 429 Too Many Requests to a sign-in of a locked account.
+func writeLocked(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed sign-in attempts, try again later", http.StatusTooManyRequests)
+}
 
+// completeSignIn finishes signing in a user whose credentials were checked. Users with
+// two-factor authentication are handed a challenge to answer with a code instead of tokens.
+func completeSignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, userTokenCollection *mongo.Collection, tokens *auth.Tokens, user models.User) {
+	if user.TOTPEnabled {
+		writeTwoFactorChallenge(w, userTokenCollection, user)
+		return
+	}
+	respondSignedIn(w, r, collection, groupCollection, expenseCollection, sessionCollection, tokens, user)
+}
+
+// respondSignedIn starts a session for a user who is fully authenticated and responds with
+// its tokens, along with the user's groups, expenses and fellow group members.
+func respondSignedIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection, groupCollection *mongo.Collection, expenseCollection *mongo.Collection, sessionCollection *mongo.Collection, tokens *auth.Tokens, user models.User) {
+	// Start a session and create its tokens
+	refreshToken, session, err := tokens.StartSession(context.TODO(), sessionCollection, user.ID, r.UserAgent())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tokenString, expiresAt, err := tokens.IssueAccessToken(user.ID, session.FamilyID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -180,7 +275,7 @@ func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection
 		}
 	}
 
-	var usersInGroups []models.User
+	var usersInGroups []models.PublicProfile
 	for userID := range userIDsSet {
 		if userID == user.ID {
 			continue // Skip the current user
@@ -190,23 +285,27 @@ func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection
 			// Handle error, note that this might fail if the user doesn't exist
 			continue
 		}
-		usersInGroups = append(usersInGroups, user)
+		usersInGroups = append(usersInGroups, user.PublicProfile())
 	}
 
 	// Return the token and additional data
 	response := struct {
-		UserId        string           `json:"userId"`
-		UserName      string           `json:"userName"`
-		Email         string           `json:"email"`
-		Token         string           `json:"token"`
-		Groups        []models.Group   `json:"groups"`
-		Expenses      []models.Expense `json:"expenses"`
-		UsersInGroups []models.User    `json:"usersInGroups"`
+		UserId        string                 `json:"userId"`
+		UserName      string                 `json:"userName"`
+		Email         string                 `json:"email"`
+		Token         string                 `json:"token"`
+		ExpiresAt     time.Time              `json:"expiresAt"`
+		RefreshToken  string                 `json:"refreshToken"`
+		Groups        []models.Group         `json:"groups"`
+		Expenses      []models.Expense       `json:"expenses"`
+		UsersInGroups []models.PublicProfile `json:"usersInGroups"`
 	}{
 		UserId:        user.ID.Hex(),
 		UserName:      user.Name,
 		Email:         user.Email,
 		Token:         tokenString,
+		ExpiresAt:     expiresAt,
+		RefreshToken:  refreshToken,
 		Groups:        groups,
 		Expenses:      expenses,
 		UsersInGroups: usersInGroups,
@@ -219,7 +318,18 @@ func SignIn(w http.ResponseWriter, r *http.Request, collection *mongo.Collection
 	}
 }
 
-// GetUserByEmail finds a user by their email address.
+// currentUserID returns the signed-in user's ID from the request context, responding
+// with 401 Unauthorized when the request was not authenticated.
+func currentUserID(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return userID, ok
+}
+
+// GetUserByEmail finds a user by their email address, so they can be added to a group.
+// Only the user's ID and name are returned.
 func GetUserByEmail(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
 	// Extract email from query parameters
 	email := r.URL.Query().Get("email")
@@ -229,7 +339,7 @@ func GetUserByEmail(w http.ResponseWriter, r *http.Request, collection *mongo.Co
 	}
 
 	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	err := collection.FindOne(context.TODO(), bson.M{"email": email, "placeholder": bson.M{"$ne": true}}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -240,13 +350,14 @@ func GetUserByEmail(w http.ResponseWriter, r *http.Request, collection *mongo.Co
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user)
+	err = json.NewEncoder(w).Encode(user.LookupProfile())
 	if err != nil {
 		return
 	}
 }
 
-// GetUserByPhoneNumber finds a user by their mobile number.
+// GetUserByPhoneNumber finds a user by their mobile number, so they can be added to a group.
+// Only the user's ID and name are returned.
 func GetUserByPhoneNumber(w http.ResponseWriter, r *http.Request, collection *mongo.Collection) {
 	// Extract mobile number from query parameters
 	mobileNumber := r.URL.Query().Get("mobileNumber")
@@ -256,7 +367,7 @@ func GetUserByPhoneNumber(w http.ResponseWriter, r *http.Request, collection *mo
 	}
 
 	var user models.User
-	err := collection.FindOne(context.TODO(), bson.M{"mobileNumber": mobileNumber}).Decode(&user)
+	err := collection.FindOne(context.TODO(), bson.M{"mobileNumber": mobileNumber, "placeholder": bson.M{"$ne": true}}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			http.Error(w, "User not found", http.StatusNotFound)
@@ -267,7 +378,7 @@ func GetUserByPhoneNumber(w http.ResponseWriter, r *http.Request, collection *mo
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(user)
+	err = json.NewEncoder(w).Encode(user.LookupProfile())
 	if err != nil {
 		return
 	}
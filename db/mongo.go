@@ -3,14 +3,15 @@ package db
 
 import (
 	"context"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 )
 
-// Connect establishes a connection to the MongoDB database.
-func Connect() *mongo.Client {
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update the URI as needed.
+// Connect establishes a connection to the MongoDB deployment at uri.
+func Connect(uri string) *mongo.Client {
+	clientOptions := options.Client().ApplyURI(uri)
 	client, err := mongo.Connect(context.TODO(), clientOptions)
 	if err != nil {
 		log.Fatal(err)
@@ -26,14 +27,58 @@ func Connect() *mongo.Client {
 }
 
 // GetUsersCollection returns a handle to the users collection in the database.
-func GetUsersCollection(client *mongo.Client) *mongo.Collection {
-	return client.Database("mySplit").Collection("users")
+func GetUsersCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("users")
 }
 
-func GetGroupsCollection(client *mongo.Client) *mongo.Collection {
-	return client.Database("mySplit").Collection("groups")
+func GetGroupsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("groups")
 }
 
-func GetExpenseCollection(client *mongo.Client) *mongo.Collection {
-	return client.Database("mySplit").Collection("expenses")
+func GetExpenseCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("expenses")
+}
+
+func GetSettlementsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("settlements")
+}
+
+func GetSessionsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("sessions")
+}
+
+func GetUserTokensCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("userTokens")
+}
+
+func GetOTPsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("otps")
+}
+
+func GetOIDCLoginsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("oidcLogins")
+}
+
+func GetRateLimitsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("rateLimits")
+}
+
+func GetInvitationsCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("invitations")
+}
+
+func GetExchangeRatesCollection(database *mongo.Database) *mongo.Collection {
+	return database.Collection("exchangeRates")
+}
+
+// SetMissingGroupCurrency gives groups created before groups had a base currency the given
+// one, so that their balances convert amounts in other currencies instead of adding them up.
+func SetMissingGroupCurrency(ctx context.Context, groups *mongo.Collection, currency string) (int64, error) {
+	result, err := groups.UpdateMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"currency": bson.M{"$exists": false}}, bson.M{"currency": bson.M{"$in": bson.A{"", nil}}}}},
+		bson.M{"$set": bson.M{"currency": currency}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
 }
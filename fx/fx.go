@@ -0,0 +1,81 @@
+// Package fx provides the exchange rates used to convert expenses into a group's base currency.
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrRateNotFound is returned when a provider has no rate for a currency pair.
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateProvider looks up exchange rates.
+type RateProvider interface {
+	// Rate returns how many units of to one unit of from is worth at the given time.
+	Rate(from, to string, at time.Time) (float64, error)
+}
+
+// StaticRates is a RateProvider backed by a fixed table of rates against a single base currency.
+type StaticRates struct {
+	Base  string             `json:"base"`  // Currency the rates are quoted against
+	Rates map[string]float64 `json:"rates"` // Units of each currency that one unit of Base buys
+}
+
+// LoadFile reads a StaticRates table from a JSON file such as
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "INR": 83.1}}
+func LoadFile(path string) (*StaticRates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rates StaticRates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	normalized, err := NewStaticRates(rates.Base, rates.Rates)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return normalized, nil
+}
+
+// NewStaticRates builds a rate table from the units of each currency that one unit of base
+// buys. Currency codes are matched case-insensitively.
+func NewStaticRates(base string, rates map[string]float64) (*StaticRates, error) {
+	if base == "" {
+		return nil, errors.New("base currency is required")
+	}
+	normalized := make(map[string]float64, len(rates)+1)
+	for currency, rate := range rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("rate for %s must be positive", currency)
+		}
+		normalized[strings.ToUpper(currency)] = rate
+	}
+	base = strings.ToUpper(base)
+	normalized[base] = 1
+	return &StaticRates{Base: base, Rates: normalized}, nil
+}
+
+// Rate returns the rate between two currencies, crossing through the base currency when needed.
+// The table does not change over time, so at is ignored.
+func (s *StaticRates) Rate(from, to string, at time.Time) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+	fromRate, ok := s.Rates[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, to)
+	}
+	toRate, ok := s.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, to)
+	}
+	return toRate / fromRate, nil
+}
@@ -0,0 +1,89 @@
+package fx
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	rates, err := LoadFile(writeFile(t, `{"base": "usd", "rates": {"eur": 0.8, "JPY": 150}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates.Base != "USD" {
+		t.Errorf("Base = %q, want USD", rates.Base)
+	}
+	if rates.Rates["USD"] != 1 || rates.Rates["EUR"] != 0.8 {
+		t.Errorf("Rates = %v", rates.Rates)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid JSON", content: `{"base": `},
+		{name: "no base", content: `{"rates": {"EUR": 0.8}}`},
+		{name: "zero rate", content: `{"base": "USD", "rates": {"EUR": 0}}`},
+		{name: "negative rate", content: `{"base": "USD", "rates": {"EUR": -1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadFile(writeFile(t, tt.content)); err == nil {
+				t.Fatal("LoadFile() succeeded, want an error")
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadFile() of a missing file succeeded")
+	}
+}
+
+func TestStaticRatesRate(t *testing.T) {
+	rates, err := NewStaticRates("USD", map[string]float64{"EUR": 0.8, "JPY": 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{from: "USD", to: "USD", want: 1},
+		{from: "GBP", to: "gbp", want: 1},
+		{from: "USD", to: "EUR", want: 0.8},
+		{from: "eur", to: "usd", want: 1.25},
+		{from: "EUR", to: "JPY", want: 187.5},
+	}
+	for _, tt := range tests {
+		got, err := rates.Rate(tt.from, tt.to, time.Now())
+		if err != nil {
+			t.Errorf("Rate(%s, %s): %v", tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Rate(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	for _, pair := range [][2]string{{"USD", "GBP"}, {"GBP", "EUR"}} {
+		if _, err := rates.Rate(pair[0], pair[1], time.Now()); !errors.Is(err, ErrRateNotFound) {
+			t.Errorf("Rate(%s, %s) error = %v, want ErrRateNotFound", pair[0], pair[1], err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// MongoRates is a RateProvider backed by snapshots of rates stored in MongoDB, such as
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "INR": 83.1}, "asOf": ISODate("2026-10-01")}
+//
+// The rates at a given time are those of the latest snapshot taken at or before it.
+// Snapshots are written by whatever imports rates; the server only reads them.
+type MongoRates struct {
+	collection *mongo.Collection
+}
+
+// rateSnapshot is a stored table of rates against a base currency.
+type rateSnapshot struct {
+	Base  string             `bson:"base"`
+	Rates map[string]float64 `bson:"rates"`
+	AsOf  time.Time          `bson:"asOf"`
+}
+
+// NewMongoRates returns a MongoRates reading snapshots from collection, creating the index
+// used to find the snapshot in effect at a given time.
+func NewMongoRates(ctx context.Context, collection *mongo.Collection) (*MongoRates, error) {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "asOf", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoRates{collection: collection}, nil
+}
+
+// Rate returns the rate between two currencies from the latest snapshot taken at or before at.
+func (m *MongoRates) Rate(from, to string, at time.Time) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+	var snapshot rateSnapshot
+	err := m.collection.FindOne(context.TODO(),
+		bson.M{"asOf": bson.M{"$lte": at}},
+		options.FindOne().SetSort(bson.D{{Key: "asOf", Value: -1}}),
+	).Decode(&snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, fmt.Errorf("%w: no rates as of %s", ErrRateNotFound, at.Format(time.DateOnly))
+	}
+	if err != nil {
+		return 0, err
+	}
+	rates, err := NewStaticRates(snapshot.Base, snapshot.Rates)
+	if err != nil {
+		return 0, fmt.Errorf("rates as of %s: %w", snapshot.AsOf.Format(time.DateOnly), err)
+	}
+	return rates.Rate(from, to, at)
+}
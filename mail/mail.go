@@ -0,0 +1,91 @@
+// Package mail sends the emails the server needs, such as verification and password reset links.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SMTPMailer delivers emails through an SMTP server, authenticating with PLAIN auth when a username is set.
+type SMTPMailer struct {
+	Addr     string // host:port of the SMTP server
+	From     string // Sender address
+	Username string
+	Password string
+}
+
+// Send delivers the message to the SMTP server.
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{message.To}, format(m.From, message))
+}
+
+// LogMailer writes emails to a file, or to the standard logger when no file is set, instead
+// of sending them. It is meant for development and tests.
+type LogMailer struct {
+	Path string // File the emails are appended to
+	mu   sync.Mutex
+}
+
+// Send records the message.
+func (m *LogMailer) Send(ctx context.Context, message Message) error {
+	if m.Path == "" {
+		log.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "Date: %s\n%s\n\n", time.Now().Format(time.RFC1123Z), format("", message))
+	return err
+}
+
+// format renders the message with its headers.
+func format(from string, message Message) []byte {
+	var b strings.Builder
+	if from != "" {
+		fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	}
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(message.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(message.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(message.Body)
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so a value cannot inject extra headers.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
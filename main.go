@@ -2,68 +2,315 @@ package main
 
 import (
 	"context"
+	"flag"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
 	"log"
+	"mySplitBackEnd/auth"
+	"mySplitBackEnd/config"
 	"mySplitBackEnd/controllers"
 	"mySplitBackEnd/db"
+	"mySplitBackEnd/fx"
+	"mySplitBackEnd/mail"
+	"mySplitBackEnd/membership"
+	"mySplitBackEnd/oidc"
+	"mySplitBackEnd/ratelimit"
+	"mySplitBackEnd/sms"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
 func main() {
-	client := db.Connect()
+	configPath := flag.String("config", os.Getenv("MYSPLIT_CONFIG"), "path to a YAML or JSON config file")
+	flag.Parse()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := db.Connect(cfg.MongoURI)
 	defer func(client *mongo.Client, ctx context.Context) {
 		err := client.Disconnect(ctx)
 		if err != nil {
 			log.Println(err)
 		}
 	}(client, context.TODO())
-	usersCollection := db.GetUsersCollection(client)
-	groupCollection := db.GetGroupsCollection(client)
-	expenseCollection := db.GetExpenseCollection(client)
+	database := client.Database(cfg.Database)
+	usersCollection := db.GetUsersCollection(database)
+	groupCollection := db.GetGroupsCollection(database)
+	expenseCollection := db.GetExpenseCollection(database)
+	settlementCollection := db.GetSettlementsCollection(database)
+	sessionCollection := db.GetSessionsCollection(database)
+	userTokenCollection := db.GetUserTokensCollection(database)
+	otpCollection := db.GetOTPsCollection(database)
+	oidcLoginCollection := db.GetOIDCLoginsCollection(database)
+	invitationCollection := db.GetInvitationsCollection(database)
+	memberships := membership.Collections{Users: usersCollection, Groups: groupCollection, Expenses: expenseCollection, Settlements: settlementCollection}
+	tokens, err := auth.NewTokens(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var rates fx.RateProvider
+	if cfg.ExchangeRates == "mongo" {
+		rates, err = fx.NewMongoRates(context.TODO(), db.GetExchangeRatesCollection(database))
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		rates, err = fx.LoadFile(cfg.ExchangeRatesFile)
+		if err != nil {
+			// Without a rate table only expenses in a group's own currency can be recorded
+			log.Printf("Could not load exchange rates: %v", err)
+			rates = &fx.StaticRates{}
+		}
+	}
+
+	// Balances are only meaningful in a single currency, so every group needs one
+	if n, err := db.SetMissingGroupCurrency(context.TODO(), groupCollection, cfg.DefaultCurrency); err != nil {
+		log.Fatal(err)
+	} else if n > 0 {
+		log.Printf("Set the base currency of %d groups to %s", n, cfg.DefaultCurrency)
+	}
+
+	if err := auth.CreateIndexes(context.TODO(), sessionCollection, userTokenCollection, otpCollection, invitationCollection); err != nil {
+		log.Fatal(err)
+	}
+	if err := oidc.CreateLoginIndexes(context.TODO(), oidcLoginCollection); err != nil {
+		log.Fatal(err)
+	}
+
+	var mailer mail.Mailer = &mail.LogMailer{Path: cfg.MailLogFile}
+	if cfg.SMTPAddr != "" {
+		mailer = &mail.SMTPMailer{Addr: cfg.SMTPAddr, From: cfg.MailFrom, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	}
+
+	providers := oidc.NewProviders(cfg.OIDCProviders)
+	// Only a web app served over HTTPS can be sent cookies that are Secure
+	secureCookies := strings.HasPrefix(cfg.PublicURL, "https://")
+
+	var limits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "mongo" {
+		limits, err = ratelimit.NewMongoStore(context.TODO(), db.GetRateLimitsCollection(database))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	proxies := 0
+	if cfg.TrustProxyHeaders {
+		proxies = cfg.TrustedProxyHops
+	}
+	byIP := ratelimit.ByIP(proxies)
+	byUser := func(r *http.Request) string {
+		userID, _ := auth.UserID(r.Context())
+		return userID.Hex()
+	}
+	perIP := func(name string, limit ratelimit.Limit) func(http.Handler) http.Handler {
+		return ratelimit.Middleware(limits, name, limit, byIP)
+	}
+
+	// Without an SMS gateway, text messages are only logged in development, as they carry
+	// sign-in codes and invitation links; elsewhere no text messages are sent at all
+	var smsSender sms.SMSSender
+	switch {
+	case cfg.SMSGatewayURL != "":
+		smsSender = &sms.HTTPSender{URL: cfg.SMSGatewayURL, Token: cfg.SMSGatewayToken, From: cfg.SMSFrom}
+	case cfg.Development:
+		smsSender = sms.LogSender{}
+	default:
+		log.Println("No SMS gateway is configured; signing in by text message is turned off")
+	}
+	inviter := controllers.Inviter{Invitations: invitationCollection, Mailer: mailer, SMS: smsSender, PublicURL: cfg.PublicURL}
+
 	r := mux.NewRouter()
-	r.HandleFunc("/api/example", controllers.ExampleAPIHandler)
 
-	r.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		controllers.CreateUser(w, r, usersCollection)
+	// Signing up, signing in, refreshing a token, recovering an account and fetching the
+	// token keys are the only routes open to anonymous callers
+	r.Handle("/api/users", perIP("signup", ratelimit.PerHour(10, 5))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.CreateUser(w, r, usersCollection, userTokenCollection, mailer, cfg.PublicURL, time.Duration(cfg.EmailVerificationTTL))
+	}))).Methods("POST")
+
+	// Password guessing is also slowed down per account, on top of the lockout after repeated failures
+	r.Handle("/api/signin", perIP("signin", ratelimit.PerMinute(20, 10))(
+		ratelimit.Middleware(limits, "signin-account", ratelimit.PerHour(20, 10), ratelimit.ByJSONField("email"))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				controllers.SignIn(w, r, usersCollection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, tokens)
+			})))).Methods("POST")
+
+	r.Handle("/api/signin/2fa", perIP("signin-2fa", ratelimit.PerMinute(10, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.SignInTwoFactor(w, r, usersCollection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, tokens)
+	}))).Methods("POST")
+
+	if smsSender != nil {
+		r.Handle("/api/signin/otp/request", perIP("otp-request", ratelimit.PerHour(20, 5))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			controllers.RequestOTP(w, r, usersCollection, otpCollection, tokens, smsSender)
+		}))).Methods("POST")
+
+		r.Handle("/api/signin/otp/verify", perIP("otp-verify", ratelimit.PerMinute(10, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			controllers.VerifyOTP(w, r, usersCollection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, otpCollection, tokens, memberships)
+		}))).Methods("POST")
+	}
+
+	r.HandleFunc("/api/oidc/{provider}/login", func(w http.ResponseWriter, r *http.Request) {
+		controllers.BeginOIDCLogin(w, r, oidcLoginCollection, providers, secureCookies)
+	}).Methods("GET")
+
+	r.Handle("/api/oidc/{provider}/callback", perIP("oidc-callback", ratelimit.PerMinute(10, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.FinishOIDCLogin(w, r, usersCollection, groupCollection, expenseCollection, sessionCollection, userTokenCollection, oidcLoginCollection, providers, tokens, memberships, secureCookies)
+	}))).Methods("POST")
+
+	// Clients refresh routinely, so the limit only stops guessing refresh tokens
+	r.Handle("/api/token/refresh", perIP("token-refresh", ratelimit.PerMinute(30, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.RefreshToken(w, r, sessionCollection, tokens)
+	}))).Methods("POST")
+
+	r.Handle("/api/password/forgot", perIP("password-forgot", ratelimit.PerHour(10, 5))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.ForgotPassword(w, r, usersCollection, userTokenCollection, mailer, cfg.PublicURL, time.Duration(cfg.PasswordResetTTL))
+	}))).Methods("POST")
+
+	r.Handle("/api/password/reset", perIP("password-reset", ratelimit.PerMinute(10, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.ResetPassword(w, r, usersCollection, userTokenCollection, sessionCollection, memberships)
+	}))).Methods("POST")
+
+	r.Handle("/api/email/verify", perIP("email-verify", ratelimit.PerMinute(10, 10))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.VerifyEmail(w, r, usersCollection, userTokenCollection, memberships)
+	}))).Methods("POST")
+
+	r.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetJWKS(w, r, tokens)
+	}).Methods("GET")
+
+	// Every other route requires a valid bearer token from a session that is still signed in
+	api := r.PathPrefix("/").Subrouter()
+	api.Use(tokens.Middleware(sessionCollection))
+
+	api.HandleFunc("/api/email/verify/resend", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ResendVerificationEmail(w, r, usersCollection, userTokenCollection, mailer, cfg.PublicURL, time.Duration(cfg.EmailVerificationTTL))
+	}).Methods("POST")
+
+	api.HandleFunc("/api/2fa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		controllers.EnrollTwoFactor(w, r, usersCollection)
+	}).Methods("POST")
+
+	api.HandleFunc("/api/2fa/confirm", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ConfirmTwoFactor(w, r, usersCollection)
+	}).Methods("POST")
+
+	api.HandleFunc("/api/2fa/disable", func(w http.ResponseWriter, r *http.Request) {
+		controllers.DisableTwoFactor(w, r, usersCollection)
+	}).Methods("POST")
+
+	api.HandleFunc("/api/logout", func(w http.ResponseWriter, r *http.Request) {
+		controllers.Logout(w, r, sessionCollection)
 	}).Methods("POST")
 
-	r.HandleFunc("/api/signin", func(w http.ResponseWriter, r *http.Request) {
-		controllers.SignIn(w, r, usersCollection, groupCollection, expenseCollection)
+	api.HandleFunc("/api/logout/all", func(w http.ResponseWriter, r *http.Request) {
+		controllers.LogoutAll(w, r, sessionCollection)
 	}).Methods("POST")
 
-	r.HandleFunc("/api/user/email", func(w http.ResponseWriter, r *http.Request) {
+	api.HandleFunc("/api/example", controllers.ExampleAPIHandler)
+
+	// Looking users up and adding or inviting people by email or number are limited per user so
+	// that registered emails and numbers cannot be enumerated
+	lookupLimit := ratelimit.Middleware(limits, "lookup", ratelimit.PerMinute(30, 10), byUser)
+
+	api.Handle("/api/user/email", lookupLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		controllers.GetUserByEmail(w, r, usersCollection)
-	}).Methods("GET")
+	}))).Methods("GET")
 
-	r.HandleFunc("/api/user/phoneNumber", func(w http.ResponseWriter, r *http.Request) {
+	api.Handle("/api/user/phoneNumber", lookupLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		controllers.GetUserByPhoneNumber(w, r, usersCollection)
+	}))).Methods("GET")
+
+	api.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
+		controllers.CreateGroup(w, r, usersCollection, groupCollection, inviter, cfg.DefaultCurrency)
+	}).Methods("POST")
+
+	api.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetMyGroups(w, r, groupCollection)
 	}).Methods("GET")
 
-	r.HandleFunc("/api/groups", func(w http.ResponseWriter, r *http.Request) {
-		controllers.CreateGroup(w, r, usersCollection, groupCollection) // Assuming groupCollection is defined
+	api.HandleFunc("/api/groups/{groupId}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetGroup(w, r, usersCollection, groupCollection)
+	}).Methods("GET")
+
+	api.HandleFunc("/api/groups/{groupId}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.RenameGroup(w, r, groupCollection)
+	}).Methods("PUT")
+
+	api.HandleFunc("/api/groups/{groupId}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.DeleteGroup(w, r, usersCollection, groupCollection, expenseCollection, settlementCollection)
+	}).Methods("DELETE")
+
+	api.HandleFunc("/api/groups/{groupId}/settings", func(w http.ResponseWriter, r *http.Request) {
+		controllers.UpdateGroupSettings(w, r, groupCollection)
+	}).Methods("PATCH")
+
+	api.Handle("/api/groups/{groupId}/members", lookupLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.AddGroupMember(w, r, usersCollection, groupCollection, inviter)
+	}))).Methods("POST")
+
+	api.HandleFunc("/api/groups/{groupId}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.RemoveGroupMember(w, r, usersCollection, groupCollection, expenseCollection, settlementCollection)
+	}).Methods("DELETE")
+
+	api.HandleFunc("/api/groups/{groupId}/members/{userId}/role", func(w http.ResponseWriter, r *http.Request) {
+		controllers.ChangeMemberRole(w, r, usersCollection, groupCollection)
+	}).Methods("PUT")
+
+	api.Handle("/api/groups/{groupId}/invitations", lookupLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		controllers.InviteToGroup(w, r, usersCollection, groupCollection, inviter)
+	}))).Methods("POST")
+
+	api.HandleFunc("/api/invitations/accept", func(w http.ResponseWriter, r *http.Request) {
+		controllers.AcceptInvitation(w, r, memberships, invitationCollection)
 	}).Methods("POST")
 
-	r.HandleFunc("/api/expenses", func(w http.ResponseWriter, r *http.Request) {
-		controllers.CreateExpense(w, r, expenseCollection)
+	api.HandleFunc("/api/expenses", func(w http.ResponseWriter, r *http.Request) {
+		controllers.CreateExpense(w, r, groupCollection, expenseCollection, rates)
 	}).Methods("POST")
 
-	r.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controllers.GetExpense(w, r, expenseCollection)
+	api.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetExpense(w, r, groupCollection, expenseCollection)
 	}).Methods("GET")
 
-	r.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controllers.UpdateExpense(w, r, expenseCollection)
+	api.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.UpdateExpense(w, r, groupCollection, expenseCollection, rates)
 	}).Methods("PUT")
 
-	r.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
-		controllers.DeleteExpense(w, r, expenseCollection)
+	api.HandleFunc("/api/expenses/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.DeleteExpense(w, r, groupCollection, expenseCollection)
 	}).Methods("DELETE")
 
-	r.HandleFunc("/api/groups/{groupId}/expenses", func(w http.ResponseWriter, r *http.Request) {
-		controllers.GetExpensesByGroup(w, r, expenseCollection)
+	api.HandleFunc("/api/groups/{groupId}/expenses", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetExpensesByGroup(w, r, groupCollection, expenseCollection)
+	}).Methods("GET")
+
+	api.HandleFunc("/api/groups/{groupId}/balances", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetGroupBalances(w, r, groupCollection, expenseCollection, settlementCollection)
+	}).Methods("GET")
+
+	api.HandleFunc("/api/groups/{groupId}/settle-plan", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetSettlePlan(w, r, groupCollection, expenseCollection, settlementCollection)
 	}).Methods("GET")
 
-	log.Println("Starting server on :8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	api.HandleFunc("/api/groups/{groupId}/history", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetGroupHistory(w, r, groupCollection, expenseCollection, settlementCollection)
+	}).Methods("GET")
+
+	api.HandleFunc("/api/groups/{groupId}/settlements", func(w http.ResponseWriter, r *http.Request) {
+		controllers.CreateSettlement(w, r, groupCollection, settlementCollection, rates)
+	}).Methods("POST")
+
+	api.HandleFunc("/api/groups/{groupId}/settlements", func(w http.ResponseWriter, r *http.Request) {
+		controllers.GetSettlementsByGroup(w, r, groupCollection, settlementCollection)
+	}).Methods("GET")
+
+	api.HandleFunc("/api/groups/{groupId}/settlements/{id}", func(w http.ResponseWriter, r *http.Request) {
+		controllers.DeleteSettlement(w, r, groupCollection, settlementCollection)
+	}).Methods("DELETE")
+
+	log.Println("Starting server on " + cfg.Port)
+	log.Fatal(http.ListenAndServe(cfg.Port, r))
 }
@@ -0,0 +1,170 @@
+// Package membership changes who belongs to a group, keeping Group.Users and User.Groups in
+// step by updating both sides in one transaction. Transactions need MongoDB to run as a
+// replica set; a single-node replica set is enough for development.
+package membership
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/split"
+)
+
+// ErrSuccessorLeft is returned when the user picked to take over a group from its owner is
+// no longer a member of it.
+var ErrSuccessorLeft = errors.New("the member picked to own the group has left it")
+
+// CreateGroup inserts a group and records it in the groups of each of its members.
+func CreateGroup(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, group models.Group) error {
+	return withTransaction(ctx, groups, func(sc mongo.SessionContext) error {
+		if _, err := groups.InsertOne(sc, group); err != nil {
+			return err
+		}
+		return addGroupToUsers(sc, users, group.ID, group.Users)
+	})
+}
+
+// AddMembers adds users to a group.
+func AddMembers(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, groupID primitive.ObjectID, memberIDs []primitive.ObjectID) error {
+	return withTransaction(ctx, groups, func(sc mongo.SessionContext) error {
+		_, err := groups.UpdateOne(sc,
+			bson.M{"_id": groupID},
+			bson.M{"$addToSet": bson.M{"users": bson.M{"$each": memberIDs}}})
+		if err != nil {
+			return err
+		}
+		return addGroupToUsers(sc, users, groupID, memberIDs)
+	})
+}
+
+// RemoveMember removes a user from a group, along with their role and their place among
+// the group's default participants.
+func RemoveMember(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, groupID primitive.ObjectID, memberID primitive.ObjectID) error {
+	return withTransaction(ctx, groups, func(sc mongo.SessionContext) error {
+		var group models.Group
+		if err := groups.FindOne(sc, bson.M{"_id": groupID}).Decode(&group); err != nil {
+			return err
+		}
+		_, err := groups.UpdateOne(sc, bson.M{"_id": groupID}, leaveUpdate(group, memberID, bson.M{}))
+		if err != nil {
+			return err
+		}
+		return removeGroupFromUsers(sc, users, groupID, bson.M{"_id": memberID})
+	})
+}
+
+// RemoveOwner removes the owner from a group and makes the successor its owner. Nothing
+// changes and ErrSuccessorLeft is returned when the successor is no longer a member.
+func RemoveOwner(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, groupID primitive.ObjectID, ownerID primitive.ObjectID, successorID primitive.ObjectID) error {
+	return withTransaction(ctx, groups, func(sc mongo.SessionContext) error {
+		var group models.Group
+		err := groups.FindOne(sc, bson.M{"_id": groupID, "users": successorID}).Decode(&group)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrSuccessorLeft
+		}
+		if err != nil {
+			return err
+		}
+		update := leaveUpdate(group, ownerID, bson.M{"roles." + successorID.Hex(): models.RoleOwner})
+		if _, err := groups.UpdateOne(sc, bson.M{"_id": groupID}, update); err != nil {
+			return err
+		}
+		return removeGroupFromUsers(sc, users, groupID, bson.M{"_id": ownerID})
+	})
+}
+
+// leaveUpdate builds the update that removes a member from a group with their role and
+// their place among the group's default participants, along with the fields in set.
+// Percentages of the participants who remain are scaled back up to 100, and the defaults go
+// back to an equal split among every member when nobody remains to split by percentage.
+func leaveUpdate(group models.Group, memberID primitive.ObjectID, set bson.M) bson.M {
+	unset := bson.M{"roles." + memberID.Hex(): ""}
+
+	participants := make([]models.SplitParticipant, 0, len(group.Settings.DefaultParticipants))
+	var sum float64
+	for _, p := range group.Settings.DefaultParticipants {
+		if p.UserID != memberID {
+			participants = append(participants, p)
+			sum += p.Value
+		}
+	}
+	percentage := split.Mode(group.Settings.DefaultSplitMode) == split.ModePercentage
+	switch {
+	case len(participants) == len(group.Settings.DefaultParticipants):
+		// The member was not among the default participants
+	case percentage && sum <= 0:
+		unset["settings.defaultSplitMode"] = ""
+		unset["settings.defaultParticipants"] = ""
+	case len(participants) == 0:
+		unset["settings.defaultParticipants"] = ""
+	default:
+		if percentage {
+			for i := range participants {
+				participants[i].Value = participants[i].Value * 100 / sum
+			}
+		}
+		set["settings.defaultParticipants"] = participants
+	}
+
+	update := bson.M{
+		"$pull":  bson.M{"users": memberID},
+		"$unset": unset,
+	}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	return update
+}
+
+// DeleteGroup deletes a group with its expenses and settlements, and removes it from the
+// groups of its members.
+func DeleteGroup(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, expenses *mongo.Collection, settlements *mongo.Collection, groupID primitive.ObjectID) error {
+	return withTransaction(ctx, groups, func(sc mongo.SessionContext) error {
+		if _, err := expenses.DeleteMany(sc, bson.M{"groupId": groupID}); err != nil {
+			return err
+		}
+		if _, err := settlements.DeleteMany(sc, bson.M{"groupId": groupID}); err != nil {
+			return err
+		}
+		if _, err := groups.DeleteOne(sc, bson.M{"_id": groupID}); err != nil {
+			return err
+		}
+		return removeGroupFromUsers(sc, users, groupID, bson.M{"groups": groupID})
+	})
+}
+
+// withTransaction runs fn in a transaction, retrying it on transient errors.
+func withTransaction(ctx context.Context, coll *mongo.Collection, fn func(sc mongo.SessionContext) error) error {
+	session, err := coll.Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// addGroupToUsers adds the group to the groups of the users. It uses an update pipeline
+// because users created before groups were tracked have no groups array to add to.
+func addGroupToUsers(ctx context.Context, users *mongo.Collection, groupID primitive.ObjectID, userIDs []primitive.ObjectID) error {
+	_, err := users.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": userIDs}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"groups": bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$groups", bson.A{}}}, bson.A{groupID}}},
+		}}}})
+	return err
+}
+
+// removeGroupFromUsers removes the group from the groups of the users matching filter.
+func removeGroupFromUsers(ctx context.Context, users *mongo.Collection, groupID primitive.ObjectID, filter bson.M) error {
+	_, err := users.UpdateMany(ctx, filter,
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"groups": bson.M{"$setDifference": bson.A{bson.M{"$ifNull": bson.A{"$groups", bson.A{}}}, bson.A{groupID}}},
+		}}}})
+	return err
+}
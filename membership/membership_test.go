@@ -0,0 +1,101 @@
+package membership
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/split"
+	"reflect"
+	"testing"
+)
+
+func TestLeaveUpdate(t *testing.T) {
+	a, b, c, d := user(1), user(2), user(3), user(4)
+	group := func(mode string, participants ...models.SplitParticipant) models.Group {
+		return models.Group{
+			Users:    []primitive.ObjectID{a, b, c, d},
+			Settings: models.GroupSettings{DefaultSplitMode: mode, DefaultParticipants: participants},
+		}
+	}
+	unsetRole := func(fields ...string) bson.M {
+		unset := bson.M{"roles." + c.Hex(): ""}
+		for _, field := range fields {
+			unset[field] = ""
+		}
+		return unset
+	}
+
+	tests := []struct {
+		name  string
+		group models.Group
+		set   bson.M
+		want  bson.M
+	}{
+		{
+			name:  "percentages of the others are scaled back up to 100",
+			group: group("percentage", models.SplitParticipant{UserID: a, Value: 50}, models.SplitParticipant{UserID: b, Value: 30}, models.SplitParticipant{UserID: c, Value: 20}),
+			want: bson.M{
+				"$pull":  bson.M{"users": c},
+				"$set":   bson.M{"settings.defaultParticipants": []models.SplitParticipant{{UserID: a, Value: 62.5}, {UserID: b, Value: 37.5}}},
+				"$unset": unsetRole(),
+			},
+		},
+		{
+			name:  "percentages go back to an equal split when nobody else has a share",
+			group: group("percentage", models.SplitParticipant{UserID: c, Value: 100}, models.SplitParticipant{UserID: d, Value: 0}),
+			want: bson.M{
+				"$pull":  bson.M{"users": c},
+				"$unset": unsetRole("settings.defaultSplitMode", "settings.defaultParticipants"),
+			},
+		},
+		{
+			name:  "shares of the others are kept",
+			group: group("shares", models.SplitParticipant{UserID: a, Value: 2}, models.SplitParticipant{UserID: c, Value: 1}),
+			want: bson.M{
+				"$pull":  bson.M{"users": c},
+				"$set":   bson.M{"settings.defaultParticipants": []models.SplitParticipant{{UserID: a, Value: 2}}},
+				"$unset": unsetRole(),
+			},
+		},
+		{
+			name:  "shares go back to every member when nobody else is left",
+			group: group("shares", models.SplitParticipant{UserID: c, Value: 1}),
+			want: bson.M{
+				"$pull":  bson.M{"users": c},
+				"$unset": unsetRole("settings.defaultParticipants"),
+			},
+		},
+		{
+			name:  "defaults the member was not part of are left alone",
+			group: group("percentage", models.SplitParticipant{UserID: a, Value: 60}, models.SplitParticipant{UserID: b, Value: 40}),
+			set:   bson.M{"roles." + a.Hex(): models.RoleOwner},
+			want: bson.M{
+				"$pull":  bson.M{"users": c},
+				"$set":   bson.M{"roles." + a.Hex(): models.RoleOwner},
+				"$unset": unsetRole(),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := tt.set
+			if set == nil {
+				set = bson.M{}
+			}
+			got := leaveUpdate(tt.group, c, set)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("leaveUpdate() = %v, want %v", got, tt.want)
+			}
+
+			// What remains must still be a split the group's expenses can default to
+			if set, ok := got["$set"].(bson.M); ok {
+				if participants, ok := set["settings.defaultParticipants"].([]models.SplitParticipant); ok {
+					mode := split.Mode(tt.group.Settings.DefaultSplitMode)
+					if _, err := split.Compute(eur(10000), mode, participants); err != nil {
+						t.Errorf("split.Compute(%s) of the remaining defaults: %v", mode, err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/models"
+)
+
+// ErrNotPlaceholder is returned when merging a user who is not a placeholder.
+var ErrNotPlaceholder = errors.New("user is not a placeholder")
+
+// ErrInvitationWithdrawn is returned when accepting an invitation to a group that was
+// deleted, or whose placeholder was removed from it or already merged into someone.
+var ErrInvitationWithdrawn = errors.New("the invitation is no longer valid")
+
+// Collections are the collections that refer to users by ID, and so must be updated when a
+// placeholder is merged into a registered user.
+type Collections struct {
+	Users       *mongo.Collection
+	Groups      *mongo.Collection
+	Expenses    *mongo.Collection
+	Settlements *mongo.Collection
+}
+
+// FindOrCreatePlaceholder returns the placeholder user for an invitee with the email or
+// mobile number, creating one with the name when there is none yet.
+func FindOrCreatePlaceholder(ctx context.Context, users *mongo.Collection, name, email, mobileNumber string) (models.User, error) {
+	var contacts []bson.M
+	if email != "" {
+		contacts = append(contacts, bson.M{"email": email})
+	}
+	if mobileNumber != "" {
+		contacts = append(contacts, bson.M{"mobileNumber": mobileNumber})
+	}
+	if len(contacts) == 0 {
+		return models.User{}, errors.New("an email or mobile number is required")
+	}
+
+	var placeholder models.User
+	err := users.FindOne(ctx, bson.M{"placeholder": true, "$or": contacts}).Decode(&placeholder)
+	if err == nil || !errors.Is(err, mongo.ErrNoDocuments) {
+		return placeholder, err
+	}
+
+	if name == "" {
+		name = email
+		if name == "" {
+			name = mobileNumber
+		}
+	}
+	placeholder = models.User{
+		ID:           primitive.NewObjectID(),
+		Name:         name,
+		Email:        email,
+		MobileNumber: mobileNumber,
+		Placeholder:  true,
+		Groups:       []primitive.ObjectID{},
+	}
+	_, err = users.InsertOne(ctx, placeholder)
+	return placeholder, err
+}
+
+// ClaimPlaceholders merges into a registered user the placeholders created for their email,
+// when matchEmail is set, and for their mobile number, when matchMobile is set. Callers
+// only set them once the user proved they own the address or number.
+func ClaimPlaceholders(ctx context.Context, c Collections, user models.User, matchEmail, matchMobile bool) error {
+	var contacts []bson.M
+	if matchEmail && user.Email != "" {
+		contacts = append(contacts, bson.M{"email": user.Email})
+	}
+	if matchMobile && user.MobileNumber != "" {
+		contacts = append(contacts, bson.M{"mobileNumber": user.MobileNumber})
+	}
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	cursor, err := c.Users.Find(ctx, bson.M{"placeholder": true, "$or": contacts})
+	if err != nil {
+		return err
+	}
+	var placeholders []models.User
+	if err := cursor.All(ctx, &placeholders); err != nil {
+		return err
+	}
+	for _, placeholder := range placeholders {
+		if err := MergePlaceholder(ctx, c, placeholder.ID, user.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergePlaceholder hands everything a placeholder took part in over to a registered user,
+// in one transaction: its group memberships and its places in expenses and settlements.
+// Where both took part in the same expense, their entries are combined; settlements between
+// the two are dropped, as the user would have paid themselves. The placeholder is then deleted.
+func MergePlaceholder(ctx context.Context, c Collections, placeholderID primitive.ObjectID, userID primitive.ObjectID) error {
+	return withTransaction(ctx, c.Groups, func(sc mongo.SessionContext) error {
+		return mergePlaceholder(sc, c, placeholderID, userID)
+	})
+}
+
+// AcceptInvitation merges the placeholder an invitation to a group was sent for into the
+// user accepting it, like MergePlaceholder. It returns ErrInvitationWithdrawn, changing
+// nothing, unless the group still exists and the placeholder is still one of its members.
+func AcceptInvitation(ctx context.Context, c Collections, groupID primitive.ObjectID, placeholderID primitive.ObjectID, userID primitive.ObjectID) error {
+	return withTransaction(ctx, c.Groups, func(sc mongo.SessionContext) error {
+		count, err := c.Groups.CountDocuments(sc, bson.M{"_id": groupID, "users": placeholderID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInvitationWithdrawn
+		}
+		err = mergePlaceholder(sc, c, placeholderID, userID)
+		if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, ErrNotPlaceholder) {
+			return ErrInvitationWithdrawn
+		}
+		return err
+	})
+}
+
+// mergePlaceholder does the work of MergePlaceholder within a transaction.
+func mergePlaceholder(sc mongo.SessionContext, c Collections, placeholderID primitive.ObjectID, userID primitive.ObjectID) error {
+	var placeholder models.User
+	err := c.Users.FindOne(sc, bson.M{"_id": placeholderID}).Decode(&placeholder)
+	if err != nil {
+		return err
+	}
+	if !placeholder.Placeholder {
+		return ErrNotPlaceholder
+	}
+
+	// The user takes over the placeholder's role, unless they already have one in the group
+	_, err = c.Groups.UpdateMany(sc,
+		bson.M{"users": bson.M{"$all": bson.A{placeholderID, userID}}},
+		bson.M{"$unset": bson.M{"roles." + placeholderID.Hex(): ""}})
+	if err != nil {
+		return err
+	}
+	_, err = c.Groups.UpdateMany(sc,
+		bson.M{"users": placeholderID, "roles." + placeholderID.Hex(): bson.M{"$exists": true}},
+		bson.M{"$rename": bson.M{"roles." + placeholderID.Hex(): "roles." + userID.Hex()}})
+	if err != nil {
+		return err
+	}
+	_, err = c.Groups.UpdateMany(sc, bson.M{"users": placeholderID}, bson.M{"$addToSet": bson.M{"users": userID}})
+	if err != nil {
+		return err
+	}
+	_, err = c.Groups.UpdateMany(sc, bson.M{"users": placeholderID}, bson.M{"$pull": bson.M{"users": placeholderID}})
+	if err != nil {
+		return err
+	}
+	// Both may be among a group's default participants, with shares to combine
+	cursor, err := c.Groups.Find(sc, bson.M{"settings.defaultParticipants.userId": placeholderID})
+	if err != nil {
+		return err
+	}
+	var groups []models.Group
+	if err := cursor.All(sc, &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		_, err = c.Groups.UpdateOne(sc,
+			bson.M{"_id": group.ID},
+			bson.M{"$set": bson.M{"settings.defaultParticipants": mergeParticipants(group.Settings.DefaultParticipants, placeholderID, userID)}})
+		if err != nil {
+			return err
+		}
+	}
+	if err := addGroupsToUser(sc, c.Users, userID, placeholder.Groups); err != nil {
+		return err
+	}
+
+	// Expenses are rewritten whole, as the user may already have entries to combine with
+	cursor, err = c.Expenses.Find(sc, bson.M{"$or": []bson.M{
+		{"paidBy": placeholderID},
+		{"payers.userId": placeholderID},
+		{"split.userId": placeholderID},
+		{"participants.userId": placeholderID},
+		{"items.participants": placeholderID},
+	}})
+	if err != nil {
+		return err
+	}
+	var expenses []models.Expense
+	if err := cursor.All(sc, &expenses); err != nil {
+		return err
+	}
+	for _, expense := range expenses {
+		mergeExpenseUser(&expense, placeholderID, userID)
+		if _, err := c.Expenses.ReplaceOne(sc, bson.M{"_id": expense.ID}, expense); err != nil {
+			return err
+		}
+	}
+
+	_, err = c.Settlements.DeleteMany(sc, bson.M{"$or": []bson.M{
+		{"paidBy": placeholderID, "paidTo": userID},
+		{"paidBy": userID, "paidTo": placeholderID},
+	}})
+	if err != nil {
+		return err
+	}
+	if err := replaceID(sc, c.Settlements, "paidBy", placeholderID, userID); err != nil {
+		return err
+	}
+	if err := replaceID(sc, c.Settlements, "paidTo", placeholderID, userID); err != nil {
+		return err
+	}
+
+	_, err = c.Users.DeleteOne(sc, bson.M{"_id": placeholderID})
+	return err
+}
+
+// mergeExpenseUser hands the places of one user in an expense over to another. Entries
+// both users had are combined into one by adding up their amounts, percentages or shares,
+// and the payer who paid the most becomes PaidBy again.
+func mergeExpenseUser(expense *models.Expense, from, to primitive.ObjectID) {
+	if expense.PaidBy == from {
+		expense.PaidBy = to
+	}
+
+	if len(expense.Payers) > 0 {
+		var payers []models.Payer
+		index := make(map[primitive.ObjectID]int)
+		for _, payer := range expense.Payers {
+			if payer.UserID == from {
+				payer.UserID = to
+			}
+			if i, ok := index[payer.UserID]; ok {
+				payers[i].Amount = payers[i].Amount.Add(payer.Amount)
+				continue
+			}
+			index[payer.UserID] = len(payers)
+			payers = append(payers, payer)
+		}
+		expense.Payers = payers
+		main := 0
+		for i, payer := range payers {
+			if payer.Amount.Minor > payers[main].Amount.Minor {
+				main = i
+			}
+		}
+		expense.PaidBy = payers[main].UserID
+	}
+
+	if expense.Split != nil {
+		split := []models.ExpenseSplit{}
+		index := make(map[primitive.ObjectID]int)
+		for _, s := range expense.Split {
+			if s.UserID == from {
+				s.UserID = to
+			}
+			if i, ok := index[s.UserID]; ok {
+				split[i].Amount = split[i].Amount.Add(s.Amount)
+				continue
+			}
+			index[s.UserID] = len(split)
+			split = append(split, s)
+		}
+		expense.Split = split
+	}
+
+	expense.Participants = mergeParticipants(expense.Participants, from, to)
+
+	// An item is shared by each participant once; the combined Split keeps both shares
+	for i, item := range expense.Items {
+		participants := make([]primitive.ObjectID, 0, len(item.Participants))
+		seen := make(map[primitive.ObjectID]bool)
+		for _, userID := range item.Participants {
+			if userID == from {
+				userID = to
+			}
+			if !seen[userID] {
+				seen[userID] = true
+				participants = append(participants, userID)
+			}
+		}
+		expense.Items[i].Participants = participants
+	}
+}
+
+// mergeParticipants hands the place of one user among split participants over to another,
+// adding up their values when both took part.
+func mergeParticipants(participants []models.SplitParticipant, from, to primitive.ObjectID) []models.SplitParticipant {
+	if len(participants) == 0 {
+		return participants
+	}
+	var merged []models.SplitParticipant
+	index := make(map[primitive.ObjectID]int)
+	for _, p := range participants {
+		if p.UserID == from {
+			p.UserID = to
+		}
+		if i, ok := index[p.UserID]; ok {
+			merged[i].Value += p.Value
+			continue
+		}
+		index[p.UserID] = len(merged)
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// replaceID points a field holding a user ID at another user.
+func replaceID(ctx context.Context, coll *mongo.Collection, field string, from, to primitive.ObjectID) error {
+	_, err := coll.UpdateMany(ctx, bson.M{field: from}, bson.M{"$set": bson.M{field: to}})
+	return err
+}
+
+// addGroupsToUser adds groups to the groups of a user.
+func addGroupsToUser(ctx context.Context, users *mongo.Collection, userID primitive.ObjectID, groupIDs []primitive.ObjectID) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	_, err := users.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"groups": bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$groups", bson.A{}}}, groupIDs}},
+		}}}})
+	return err
+}
@@ -0,0 +1,87 @@
+package membership
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"reflect"
+	"testing"
+)
+
+// user returns a fixed ObjectID, so that failures name users readably.
+func user(n byte) primitive.ObjectID {
+	return primitive.ObjectID{11: n}
+}
+
+func eur(minor int64) models.Money {
+	return models.NewMoney(minor, "EUR")
+}
+
+func TestMergeExpenseUser(t *testing.T) {
+	placeholder, registered, other := user(1), user(2), user(3)
+	expense := models.Expense{
+		PaidBy: other,
+		Payers: []models.Payer{{UserID: other, Amount: eur(5000)}, {UserID: placeholder, Amount: eur(3000)}, {UserID: registered, Amount: eur(4000)}},
+		Amount: eur(12000),
+		Split: []models.ExpenseSplit{
+			{UserID: placeholder, Amount: eur(3000)},
+			{UserID: registered, Amount: eur(6000)},
+			{UserID: other, Amount: eur(3000)},
+		},
+		SplitMode: "shares",
+		Participants: []models.SplitParticipant{
+			{UserID: placeholder, Value: 1},
+			{UserID: registered, Value: 2},
+			{UserID: other, Value: 1},
+		},
+		Items: []models.ExpenseItem{
+			{Name: "Pizza", Amount: eur(9000), Participants: []primitive.ObjectID{placeholder, registered, other}},
+			{Name: "Wine", Amount: eur(3000), Participants: []primitive.ObjectID{placeholder}},
+		},
+	}
+
+	mergeExpenseUser(&expense, placeholder, registered)
+
+	if expense.PaidBy != registered {
+		t.Errorf("PaidBy = %s, want the registered user, who now paid the most", expense.PaidBy.Hex())
+	}
+	wantPayers := []models.Payer{{UserID: other, Amount: eur(5000)}, {UserID: registered, Amount: eur(7000)}}
+	if !reflect.DeepEqual(expense.Payers, wantPayers) {
+		t.Errorf("Payers = %+v, want %+v", expense.Payers, wantPayers)
+	}
+	wantSplit := []models.ExpenseSplit{{UserID: registered, Amount: eur(9000)}, {UserID: other, Amount: eur(3000)}}
+	if !reflect.DeepEqual(expense.Split, wantSplit) {
+		t.Errorf("Split = %+v, want %+v", expense.Split, wantSplit)
+	}
+	wantParticipants := []models.SplitParticipant{{UserID: registered, Value: 3}, {UserID: other, Value: 1}}
+	if !reflect.DeepEqual(expense.Participants, wantParticipants) {
+		t.Errorf("Participants = %+v, want %+v", expense.Participants, wantParticipants)
+	}
+	wantItems := [][]primitive.ObjectID{{registered, other}, {registered}}
+	for i, want := range wantItems {
+		if got := expense.Items[i].Participants; !reflect.DeepEqual(got, want) {
+			t.Errorf("Items[%d].Participants = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestMergeExpenseUserWithoutOverlap(t *testing.T) {
+	placeholder, registered, other := user(1), user(2), user(3)
+	expense := models.Expense{
+		PaidBy: placeholder,
+		Amount: eur(2000),
+		Split:  []models.ExpenseSplit{{UserID: placeholder, Amount: eur(1000)}, {UserID: other, Amount: eur(1000)}},
+	}
+
+	mergeExpenseUser(&expense, placeholder, registered)
+
+	if expense.PaidBy != registered {
+		t.Errorf("PaidBy = %s, want the registered user", expense.PaidBy.Hex())
+	}
+	if expense.Payers != nil || expense.Participants != nil {
+		t.Errorf("Payers = %v and Participants = %v, want both left out", expense.Payers, expense.Participants)
+	}
+	wantSplit := []models.ExpenseSplit{{UserID: registered, Amount: eur(1000)}, {UserID: other, Amount: eur(1000)}}
+	if !reflect.DeepEqual(expense.Split, wantSplit) {
+		t.Errorf("Split = %+v, want %+v", expense.Split, wantSplit)
+	}
+}
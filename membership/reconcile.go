@@ -0,0 +1,130 @@
+package membership
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mySplitBackEnd/models"
+)
+
+// Report describes what Reconcile found.
+type Report struct {
+	GroupsScanned  int
+	UsersScanned   int
+	UsersFixed     []UserFix       // Users whose groups did not match the groups they belong to and were fixed, or would be in a dry run
+	MissingMembers []MissingMember // Members of groups that have no user document
+}
+
+// UserFix is a user whose groups were out of step with the groups' members.
+type UserFix struct {
+	UserID  primitive.ObjectID
+	Added   []primitive.ObjectID // Groups that list the user as a member but were missing from the user
+	Removed []primitive.ObjectID // Groups the user listed that do not exist or do not list the user
+}
+
+// MissingMember is a member of a group whose user does not exist.
+type MissingMember struct {
+	GroupID primitive.ObjectID
+	UserID  primitive.ObjectID
+}
+
+// Reconcile brings every User.Groups in line with the members listed in Group.Users, which
+// is what permissions are checked against. Members whose user does not exist are reported
+// but left in their groups, as expenses may still refer to them. With dryRun set nothing is
+// changed.
+func Reconcile(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, dryRun bool) (Report, error) {
+	var report Report
+
+	// Collect the groups each user belongs to according to the groups
+	memberOf := make(map[primitive.ObjectID]map[primitive.ObjectID]bool)
+	groupCursor, err := groups.Find(ctx, bson.M{})
+	if err != nil {
+		return report, err
+	}
+	defer groupCursor.Close(ctx)
+	for groupCursor.Next(ctx) {
+		var group models.Group
+		if err := groupCursor.Decode(&group); err != nil {
+			return report, err
+		}
+		report.GroupsScanned++
+		for _, userID := range group.Users {
+			if memberOf[userID] == nil {
+				memberOf[userID] = make(map[primitive.ObjectID]bool)
+			}
+			memberOf[userID][group.ID] = true
+		}
+	}
+	if err := groupCursor.Err(); err != nil {
+		return report, err
+	}
+
+	userCursor, err := users.Find(ctx, bson.M{})
+	if err != nil {
+		return report, err
+	}
+	defer userCursor.Close(ctx)
+	seen := make(map[primitive.ObjectID]bool)
+	for userCursor.Next(ctx) {
+		var user models.User
+		if err := userCursor.Decode(&user); err != nil {
+			return report, err
+		}
+		report.UsersScanned++
+		seen[user.ID] = true
+
+		fix := UserFix{UserID: user.ID}
+		expected := memberOf[user.ID]
+		listed := make(map[primitive.ObjectID]bool)
+		groupIDs := []primitive.ObjectID{}
+		for _, groupID := range user.Groups {
+			if listed[groupID] {
+				continue
+			}
+			listed[groupID] = true
+			if expected[groupID] {
+				groupIDs = append(groupIDs, groupID)
+			} else {
+				fix.Removed = append(fix.Removed, groupID)
+			}
+		}
+		for groupID := range expected {
+			if !listed[groupID] {
+				fix.Added = append(fix.Added, groupID)
+				groupIDs = append(groupIDs, groupID)
+			}
+		}
+		if len(fix.Added) == 0 && len(fix.Removed) == 0 && user.Groups != nil && len(groupIDs) == len(user.Groups) {
+			continue
+		}
+
+		if !dryRun {
+			// Users whose groups changed since they were read were updated along with a
+			// group, which keeps both sides in step, so they are left alone
+			result, err := users.UpdateOne(ctx,
+				bson.M{"_id": user.ID, "groups": user.Groups},
+				bson.M{"$set": bson.M{"groups": groupIDs}})
+			if err != nil {
+				return report, err
+			}
+			if result.ModifiedCount == 0 {
+				continue
+			}
+		}
+		report.UsersFixed = append(report.UsersFixed, fix)
+	}
+	if err := userCursor.Err(); err != nil {
+		return report, err
+	}
+
+	for userID, groupIDs := range memberOf {
+		if seen[userID] {
+			continue
+		}
+		for groupID := range groupIDs {
+			report.MissingMembers = append(report.MissingMembers, MissingMember{GroupID: groupID, UserID: userID})
+		}
+	}
+	return report, nil
+}
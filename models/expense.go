@@ -7,19 +7,56 @@ import (
 
 // Expense represents an expense in a group
 type Expense struct {
-	ID          primitive.ObjectID `bson:"_id,omitempty"`
-	GroupID     primitive.ObjectID `bson:"groupId"`     // ID of the group this expense belongs to
-	PaidBy      primitive.ObjectID `bson:"paidBy"`      // ID of the user who paid the expense
-	Amount      float64            `bson:"amount"`      // Total amount of the expense
-	Description string             `bson:"description"` // Description of the expense
-	Split       []ExpenseSplit     `bson:"split"`       // Information on how the expense is split among users
-	CreatedAt   time.Time          `bson:"createdAt"`   // Timestamp of when the expense was created
-	ModifiedAt  time.Time          `bson:"modifiedAt"`  // Timestamp of last modification
-	CreatedBy   primitive.ObjectID `bson:"createdBy"`   // ID of the user who created the expense
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	GroupID      primitive.ObjectID `bson:"groupId"`                // ID of the group this expense belongs to
+	PaidBy       primitive.ObjectID `bson:"paidBy"`                 // ID of the user who paid the expense; with several Payers, the one who paid the most
+	Payers       []Payer            `bson:"payers,omitempty"`       // Users who paid the expense together, when more than one did
+	Amount       Money              `bson:"amount"`                 // Total amount of the expense, in the currency it was paid in
+	ExchangeRate float64            `bson:"exchangeRate,omitempty"` // Rate from the expense currency to the group currency when the expense was recorded
+	Description  string             `bson:"description"`            // Description of the expense
+	Category     string             `bson:"category,omitempty"`     // Category the expense is filed under, one of the group's categories when it has any
+	Split        []ExpenseSplit     `bson:"split"`                  // Information on how the expense is split among users
+	SplitMode    string             `bson:"splitMode,omitempty"`    // Strategy used to compute Split: equal, exact, percentage, shares or itemized
+	Participants []SplitParticipant `bson:"participants,omitempty"` // Inputs to SplitMode; Split is derived from these when SplitMode is set
+	Items        []ExpenseItem      `bson:"items,omitempty"`        // Line items of an itemized receipt
+	Tax          Money              `bson:"tax,omitempty"`          // Tax on an itemized receipt, shared in proportion to each user's items
+	Tip          Money              `bson:"tip,omitempty"`          // Tip on an itemized receipt, shared in proportion to each user's items
+	CreatedAt    time.Time          `bson:"createdAt"`              // Timestamp of when the expense was created
+	ModifiedAt   time.Time          `bson:"modifiedAt"`             // Timestamp of last modification
+	CreatedBy    primitive.ObjectID `bson:"createdBy"`              // ID of the user who created the expense
+}
+
+// Payments returns who paid how much of the expense: its Payers, or PaidBy for the whole
+// Amount when the expense has a single payer
+func (e Expense) Payments() []Payer {
+	if len(e.Payers) > 0 {
+		return e.Payers
+	}
+	return []Payer{{UserID: e.PaidBy, Amount: e.Amount}}
+}
+
+// Payer is a user who paid part of an expense
+type Payer struct {
+	UserID primitive.ObjectID `bson:"userId"` // ID of the user
+	Amount Money              `bson:"amount"` // Amount this user paid
 }
 
 // ExpenseSplit represents how an individual expense is split among the users
 type ExpenseSplit struct {
 	UserID primitive.ObjectID `bson:"userId"` // ID of the user
-	Amount float64            `bson:"amount"` // Amount attributed to this user
+	Amount Money              `bson:"amount"` // Amount attributed to this user
+}
+
+// SplitParticipant is a user taking part in a split, together with the value the split mode needs:
+// ignored for equal splits, an amount for exact splits, a percentage or a number of shares
+type SplitParticipant struct {
+	UserID primitive.ObjectID `bson:"userId"` // ID of the user
+	Value  float64            `bson:"value"`  // Amount, percentage or shares, depending on the split mode
+}
+
+// ExpenseItem is a line item of an itemized receipt, shared equally by its participants
+type ExpenseItem struct {
+	Name         string               `bson:"name"`         // Name of the item, e.g. "Margherita pizza"
+	Amount       Money                `bson:"amount"`       // Price of the item
+	Participants []primitive.ObjectID `bson:"participants"` // IDs of the users sharing the item
 }
@@ -2,10 +2,55 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Role is what a member may do within a group.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // Everything admins can do, and deleting the group and transferring ownership
+	RoleAdmin  Role = "admin"  // Managing members, settings and everyone's expenses
+	RoleMember Role = "member" // Recording expenses, changing their own and adding members
+	RoleViewer Role = "viewer" // Only reading the group
+)
+
+// Valid reports whether r is one of the known roles.
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleAdmin, RoleMember, RoleViewer:
+		return true
+	}
+	return false
+}
+
 // Group represents a group of users
 type Group struct {
-	ID      primitive.ObjectID   `bson:"_id,omitempty"`
-	Name    string               `bson:"name"`
-	Users   []primitive.ObjectID `bson:"users"`   // Array of User IDs
-	Creator primitive.ObjectID   `bson:"creator"` // ID of the user who created the group
+	ID       primitive.ObjectID   `bson:"_id,omitempty"`
+	Name     string               `bson:"name"`
+	Users    []primitive.ObjectID `bson:"users"`           // Array of User IDs
+	Creator  primitive.ObjectID   `bson:"creator"`         // ID of the user who created the group
+	Roles    map[string]Role      `bson:"roles,omitempty"` // Roles by user ID hex; members without one are RoleMember
+	Currency string               `bson:"currency"`        // Base currency balances are reported in
+	Settings GroupSettings        `bson:"settings"`        // Defaults for new expenses and how debts are settled
+}
+
+// GroupSettings are a group's defaults for new expenses and how its debts are settled
+type GroupSettings struct {
+	DefaultCurrency     string             `bson:"defaultCurrency,omitempty"`     // Currency of expenses recorded without one; the group's Currency when unset
+	DefaultSplitMode    string             `bson:"defaultSplitMode,omitempty"`    // Split mode of expenses recorded without a split: equal, percentage or shares; equal when unset
+	DefaultParticipants []SplitParticipant `bson:"defaultParticipants,omitempty"` // Who such expenses are split among, with their percentages or shares; every member when unset
+	SimplifyDebts       *bool              `bson:"simplifyDebts,omitempty"`       // Whether the settle plan minimizes the number of payments; enabled when unset
+	Categories          []string           `bson:"categories,omitempty"`          // Categories expenses can be filed under; any category when unset
+}
+
+// ExpenseCurrency returns the currency of expenses recorded without one
+func (g Group) ExpenseCurrency() string {
+	if g.Settings.DefaultCurrency != "" {
+		return g.Settings.DefaultCurrency
+	}
+	return g.Currency
+}
+
+// SimplifiesDebts reports whether the group's settle plan minimizes the number of payments
+// rather than settling what each member owes each other member
+func (g Group) SimplifiesDebts() bool {
+	return g.Settings.SimplifyDebts == nil || *g.Settings.SimplifyDebts
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Invitation invites someone who has not signed up yet to a group. They take part in the
+// group as a placeholder user until they accept it or sign up and prove they own its email
+// or mobile number.
+type Invitation struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	GroupID      primitive.ObjectID `bson:"groupId"`                // ID of the group the invitation is to
+	UserID       primitive.ObjectID `bson:"userId"`                 // ID of the placeholder user standing in for the invitee
+	InvitedBy    primitive.ObjectID `bson:"invitedBy"`              // ID of the member who sent the invitation
+	Email        string             `bson:"email,omitempty"`        // Email the invitation was sent to
+	MobileNumber string             `bson:"mobileNumber,omitempty"` // Mobile number the invitation was sent to
+	TokenHash    string             `bson:"tokenHash"`              // SHA-256 of the token in the invitation link
+	CreatedAt    time.Time          `bson:"createdAt"`              // Timestamp of when the invitation was sent
+	ExpiresAt    time.Time          `bson:"expiresAt"`              // Timestamp after which the link can no longer be used
+	AcceptedAt   time.Time          `bson:"acceptedAt,omitempty"`   // Timestamp of when the invitation was accepted
+	AcceptedBy   primitive.ObjectID `bson:"acceptedBy,omitempty"`   // ID of the user who accepted the invitation
+}
@@ -0,0 +1,169 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount held as an integer number of minor units (e.g. cents) of a currency,
+// so that adding up many amounts never drifts the way float64 does.
+//
+// Money is stored in Mongo and sent as JSON as {"minor": 1234, "currency": "EUR"}. Minor
+// units mean nothing without their currency, so JSON amounts in minor units must name it.
+// For backward compatibility it also decodes plain numbers, as written by older versions
+// that stored amounts as float64, treating them as major units (e.g. 12.34).
+type Money struct {
+	Minor    int64  // Amount in minor units of Currency
+	Currency string // ISO-4217 currency code; empty when not known, in which case two decimals are assumed
+}
+
+// minorUnitExceptions lists the ISO-4217 currencies that do not use two decimal places.
+var minorUnitExceptions = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorUnits returns the number of decimal places used by a currency.
+func MinorUnits(currency string) int {
+	if digits, ok := minorUnitExceptions[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// NewMoney returns an amount of minor units in the given currency.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: strings.ToUpper(currency)}
+}
+
+// MoneyFromMajor converts an amount in major units, e.g. 12.34, into Money, rounding to the nearest minor unit.
+func MoneyFromMajor(amount float64, currency string) Money {
+	scale := math.Pow10(MinorUnits(currency))
+	return NewMoney(int64(math.Round(amount*scale)), currency)
+}
+
+// Major returns the amount in major units. It is meant for display and rates, not for arithmetic.
+func (m Money) Major() float64 {
+	return float64(m.Minor) / math.Pow10(MinorUnits(m.Currency))
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Add returns the sum of two amounts. An amount without a currency takes the other's currency.
+func (m Money) Add(other Money) Money {
+	return Money{Minor: m.Minor + other.Minor, Currency: m.currencyWith(other)}
+}
+
+// Sub returns the difference of two amounts. An amount without a currency takes the other's currency.
+func (m Money) Sub(other Money) Money {
+	return Money{Minor: m.Minor - other.Minor, Currency: m.currencyWith(other)}
+}
+
+// Neg returns the amount with its sign flipped.
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+func (m Money) currencyWith(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// WithCurrency returns the amount labelled with a currency. Amounts without a currency
+// were read with two decimals and are rescaled to the currency's minor unit.
+func (m Money) WithCurrency(currency string) Money {
+	currency = strings.ToUpper(currency)
+	if m.Currency != "" || currency == "" {
+		return m
+	}
+	scale := math.Pow10(MinorUnits(currency) - 2)
+	return Money{Minor: int64(math.Round(float64(m.Minor) * scale)), Currency: currency}
+}
+
+// String formats the amount in major units followed by its currency, e.g. "12.34 EUR".
+func (m Money) String() string {
+	amount := strconv.FormatFloat(m.Major(), 'f', MinorUnits(m.Currency), 64)
+	if m.Currency == "" {
+		return amount
+	}
+	return amount + " " + m.Currency
+}
+
+// moneyDocument is the stored and JSON form of Money.
+type moneyDocument struct {
+	Minor    int64  `json:"minor" bson:"minor"`
+	Currency string `json:"currency,omitempty" bson:"currency,omitempty"`
+}
+
+// MarshalJSON encodes the amount as {"minor": ..., "currency": ...}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyDocument{Minor: m.Minor, Currency: m.Currency})
+}
+
+// UnmarshalJSON accepts {"minor": ..., "currency": ...}, or a plain number or numeric string in major units.
+// Only a zero amount may leave out the currency in minor units.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "null" {
+		return nil
+	}
+	if strings.HasPrefix(trimmed, "{") {
+		var doc moneyDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if doc.Currency == "" && doc.Minor != 0 {
+			return errors.New("an amount in minor units needs a currency")
+		}
+		*m = NewMoney(doc.Minor, doc.Currency)
+		return nil
+	}
+	amount, err := strconv.ParseFloat(strings.Trim(trimmed, `"`), 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", trimmed)
+	}
+	*m = MoneyFromMajor(amount, "")
+	return nil
+}
+
+// MarshalBSONValue stores the amount as an embedded {minor, currency} document.
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(moneyDocument{Minor: m.Minor, Currency: m.Currency})
+}
+
+// UnmarshalBSONValue reads an embedded {minor, currency} document, or a legacy number in major units.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var doc moneyDocument
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		*m = NewMoney(doc.Minor, doc.Currency)
+	case bsontype.Double:
+		*m = MoneyFromMajor(value.Double(), "")
+	case bsontype.Int32:
+		*m = MoneyFromMajor(float64(value.Int32()), "")
+	case bsontype.Int64:
+		*m = MoneyFromMajor(float64(value.Int64()), "")
+	case bsontype.Null:
+		*m = Money{}
+	default:
+		return errors.New("cannot decode " + t.String() + " into Money")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestMoneyFromMajor(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     Money
+	}{
+		{amount: 12.34, currency: "EUR", want: Money{Minor: 1234, Currency: "EUR"}},
+		{amount: 0.1 + 0.2, currency: "usd", want: Money{Minor: 30, Currency: "USD"}},
+		{amount: 1500, currency: "JPY", want: Money{Minor: 1500, Currency: "JPY"}},
+		{amount: 1.2345, currency: "KWD", want: Money{Minor: 1235, Currency: "KWD"}},
+		{amount: -2.5, currency: "EUR", want: Money{Minor: -250, Currency: "EUR"}},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromMajor(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("MoneyFromMajor(%v, %q) = %+v, want %+v", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: NewMoney(1234, "EUR"), want: "12.34 EUR"},
+		{money: NewMoney(1500, "JPY"), want: "1500 JPY"},
+		{money: NewMoney(1234, "KWD"), want: "1.234 KWD"},
+		{money: NewMoney(-5, "USD"), want: "-0.05 USD"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	a, b := NewMoney(1000, "EUR"), NewMoney(250, "EUR")
+	if got := a.Add(b); got != NewMoney(1250, "EUR") {
+		t.Errorf("Add() = %+v", got)
+	}
+	if got := a.Sub(b); got != NewMoney(750, "EUR") {
+		t.Errorf("Sub() = %+v", got)
+	}
+	if got := (Money{Minor: 5}).Add(b); got.Currency != "EUR" {
+		t.Errorf("Add() kept no currency: %+v", got)
+	}
+	if got := b.Neg(); got != NewMoney(-250, "EUR") {
+		t.Errorf("Neg() = %+v", got)
+	}
+	if !NewMoney(0, "EUR").IsZero() || b.IsZero() {
+		t.Error("IsZero() is wrong")
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(NewMoney(1234, "EUR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"minor":1234,"currency":"EUR"}` {
+		t.Fatalf("Marshal() = %s", data)
+	}
+
+	tests := []struct {
+		input string
+		want  Money
+	}{
+		{input: `{"minor":1234,"currency":"eur"}`, want: NewMoney(1234, "EUR")},
+		{input: `12.34`, want: Money{Minor: 1234}},
+		{input: `"12.34"`, want: Money{Minor: 1234}},
+		{input: `null`, want: Money{}},
+		{input: `{"minor":0}`, want: Money{}},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.input), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{`"twelve"`, `{"minor":1500}`, `{"minor":1500,"currency":""}`} {
+		var m Money
+		if err := json.Unmarshal([]byte(input), &m); err == nil {
+			t.Errorf("Unmarshal(%s) = %+v, want an error", input, m)
+		}
+	}
+}
+
+func TestMoneyBSON(t *testing.T) {
+	type doc struct {
+		Amount Money `bson:"amount"`
+	}
+	data, err := bson.Marshal(doc{Amount: NewMoney(1500, "JPY")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got doc
+	if err := bson.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Amount != NewMoney(1500, "JPY") {
+		t.Fatalf("round trip = %+v", got.Amount)
+	}
+
+	// Documents written before amounts were stored in minor units hold a number
+	tests := []struct {
+		value interface{}
+		want  Money
+	}{
+		{value: 12.34, want: Money{Minor: 1234}},
+		{value: int32(7), want: Money{Minor: 700}},
+		{value: int64(3), want: Money{Minor: 300}},
+	}
+	for _, tt := range tests {
+		data, err := bson.Marshal(bson.M{"amount": tt.value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got doc
+		if err := bson.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%v): %v", tt.value, err)
+		}
+		if got.Amount != tt.want {
+			t.Errorf("Unmarshal(%v) = %+v, want %+v", tt.value, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestIsCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{code: "USD", want: true},
+		{code: "jpy", want: true},
+		{code: "USX", want: false},
+		{code: "EURO", want: false},
+		{code: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := IsCurrency(tt.code); got != tt.want {
+			t.Errorf("IsCurrency(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+	for code := range minorUnitExceptions {
+		if !IsCurrency(code) {
+			t.Errorf("IsCurrency(%q) = false for a currency with its own minor units", code)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// OIDCLogin is a sign-in with an OpenID Connect provider that was started but not finished.
+// It remembers the values the provider's response must match.
+type OIDCLogin struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Provider     string             `bson:"provider"`         // Name of the provider the user was sent to
+	StateHash    string             `bson:"stateHash"`        // SHA-256 of the state sent to the provider
+	BrowserHash  string             `bson:"browserHash"`      // SHA-256 of the cookie set in the browser that started the sign-in
+	Nonce        string             `bson:"nonce"`            // Nonce the ID token must carry
+	CodeVerifier string             `bson:"codeVerifier"`     // PKCE verifier sent with the authorization code
+	CreatedAt    time.Time          `bson:"createdAt"`        // Timestamp of when the sign-in started
+	ExpiresAt    time.Time          `bson:"expiresAt"`        // Timestamp after which the sign-in can no longer be finished
+	UsedAt       time.Time          `bson:"usedAt,omitempty"` // Timestamp of when the sign-in was finished
+}
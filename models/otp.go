@@ -0,0 +1,20 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// OTP is a one-time code texted to a mobile number to sign in with.
+// Codes are also recorded for numbers that belong to no user, without being sent, so that
+// rate limiting behaves the same whether or not a number is registered.
+type OTP struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	MobileNumber string             `bson:"mobileNumber"`     // Number the code was requested for
+	UserID       primitive.ObjectID `bson:"userId,omitempty"` // ID of the user the number belongs to, if any
+	CodeHash     string             `bson:"codeHash"`         // HMAC-SHA256 of the code and the ID under the server's OTP secret; the code itself is never stored
+	Attempts     int                `bson:"attempts"`         // Number of times a code was checked against this one
+	CreatedAt    time.Time          `bson:"createdAt"`        // Timestamp of when the code was requested
+	ExpiresAt    time.Time          `bson:"expiresAt"`        // Timestamp after which the code can no longer be used
+	UsedAt       time.Time          `bson:"usedAt,omitempty"` // Timestamp of when the code was used or replaced by a newer one
+}
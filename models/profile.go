@@ -0,0 +1,64 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PublicProfile is what any user may see about another user.
+// Handlers respond with a profile rather than a User so that credentials and
+// other internal fields are never serialized.
+type PublicProfile struct {
+	ID          primitive.ObjectID
+	Name        string
+	Email       string
+	Placeholder bool // Whether the user was invited and has not signed up yet
+}
+
+// LookupProfile is what a user finds out about someone by looking up their email or mobile
+// number: enough to add them to a group, without revealing their other contact details
+type LookupProfile struct {
+	ID   primitive.ObjectID
+	Name string
+}
+
+// SelfProfile is what a user sees about their own account
+type SelfProfile struct {
+	ID            primitive.ObjectID
+	Name          string
+	MobileNumber  string
+	Email         string
+	EmailVerified bool
+	Groups        []primitive.ObjectID // Array of Group IDs
+	Identities    []Identity           // Linked OpenID Connect accounts
+	TOTPEnabled   bool                 // Whether signing in requires a code from an authenticator app
+}
+
+// PublicProfile returns the user's public profile
+func (u User) PublicProfile() PublicProfile {
+	return PublicProfile{
+		ID:          u.ID,
+		Name:        u.Name,
+		Email:       u.Email,
+		Placeholder: u.Placeholder,
+	}
+}
+
+// LookupProfile returns the profile found by looking the user up
+func (u User) LookupProfile() LookupProfile {
+	return LookupProfile{
+		ID:   u.ID,
+		Name: u.Name,
+	}
+}
+
+// SelfProfile returns the profile the user sees about themselves
+func (u User) SelfProfile() SelfProfile {
+	return SelfProfile{
+		ID:            u.ID,
+		Name:          u.Name,
+		MobileNumber:  u.MobileNumber,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Groups:        u.Groups,
+		Identities:    u.Identities,
+		TOTPEnabled:   u.TOTPEnabled,
+	}
+}
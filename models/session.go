@@ -0,0 +1,22 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Session is a refresh token handed to a signed-in device.
+// Refreshing rotates the token: the session is marked as replaced and a new session in the
+// same family takes over, so a replaced token that is presented again reveals that it was stolen.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"userId"`               // ID of the signed-in user
+	FamilyID   primitive.ObjectID `bson:"familyId"`             // ID shared by every session rotated from the same sign-in
+	TokenHash  string             `bson:"tokenHash"`            // SHA-256 of the refresh token; the token itself is never stored
+	ReplacedBy primitive.ObjectID `bson:"replacedBy,omitempty"` // ID of the session this one was rotated into
+	Revoked    bool               `bson:"revoked"`              // Whether the session was signed out or found to be compromised
+	UserAgent  string             `bson:"userAgent"`            // User agent of the device that signed in
+	CreatedAt  time.Time          `bson:"createdAt"`            // Timestamp of when the refresh token was issued
+	ExpiresAt  time.Time          `bson:"expiresAt"`            // Timestamp after which the refresh token can no longer be used
+	RevokedAt  time.Time          `bson:"revokedAt,omitempty"`  // Timestamp of when the session was revoked
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Settlement records a payment made by one group member to another to pay back what they owe
+type Settlement struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	GroupID      primitive.ObjectID `bson:"groupId"`                // ID of the group this settlement belongs to
+	PaidBy       primitive.ObjectID `bson:"paidBy"`                 // ID of the user who made the payment
+	PaidTo       primitive.ObjectID `bson:"paidTo"`                 // ID of the user who received the payment
+	Amount       Money              `bson:"amount"`                 // Amount paid
+	ExchangeRate float64            `bson:"exchangeRate,omitempty"` // Rate from the settlement currency to the group currency when it was recorded
+	Note         string             `bson:"note"`                   // Optional note, e.g. how it was paid
+	CreatedAt    time.Time          `bson:"createdAt"`              // Timestamp of when the settlement was recorded
+	CreatedBy    primitive.ObjectID `bson:"createdBy"`              // ID of the user who recorded the settlement
+}
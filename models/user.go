@@ -4,19 +4,39 @@ package models
 import (
 	"github.com/dgrijalva/jwt-go"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
 // User represents a user in the system
 type User struct {
-	ID           primitive.ObjectID   `bson:"_id,omitempty"`
-	Name         string               `bson:"name"`
-	MobileNumber string               `bson:"mobileNumber"`
-	Email        string               `bson:"email"`
-	Groups       []primitive.ObjectID `bson:"groups"` // Array of Group IDs
-	Password     string               `bson:"password"`
+	ID              primitive.ObjectID   `bson:"_id,omitempty"`
+	Name            string               `bson:"name"`
+	MobileNumber    string               `bson:"mobileNumber"`
+	Email           string               `bson:"email"`
+	Placeholder     bool                 `bson:"placeholder,omitempty"`              // Whether this is someone invited to a group who has not signed up yet
+	EmailVerified   bool                 `bson:"emailVerified"`                      // Whether the user proved they control Email
+	Groups          []primitive.ObjectID `bson:"groups"`                             // Array of Group IDs
+	Password        string               `bson:"password" json:"-"`                  // bcrypt hash; never serialized to JSON
+	Identities      []Identity           `bson:"identities,omitempty"`               // Accounts at OpenID Connect providers the user signs in with
+	FailedLogins    int                  `bson:"failedLogins"`                       // Wrong passwords entered since the last successful sign-in
+	LockedUntil     time.Time            `bson:"lockedUntil,omitempty"`              // Password sign-in is refused until this time
+	TOTPEnabled     bool                 `bson:"totpEnabled"`                        // Whether signing in also requires a code from an authenticator app
+	TOTPSecret      string               `bson:"totpSecret,omitempty" json:"-"`      // Base32 secret shared with the authenticator app; set before enrolment is confirmed
+	TOTPLastCounter int64                `bson:"totpLastCounter,omitempty" json:"-"` // Time step of the last accepted code, so codes cannot be replayed
+	RecoveryCodes   []string             `bson:"recoveryCodes,omitempty" json:"-"`   // bcrypt hashes of the unused recovery codes
 }
 
+// Identity is an account at an OpenID Connect provider linked to a user
+type Identity struct {
+	Provider string    `bson:"provider"` // Name of the configured provider
+	Subject  string    `bson:"subject"`  // ID of the account at the provider
+	Email    string    `bson:"email"`    // Email the provider reported when the account was linked
+	LinkedAt time.Time `bson:"linkedAt"` // Timestamp of when the account was linked
+}
+
+// Claims are the contents of the access tokens issued at sign-in
 type Claims struct {
-	UserID primitive.ObjectID `json:"userId"`
+	UserID    primitive.ObjectID `json:"userId"`
+	SessionID primitive.ObjectID `json:"sid"` // Family ID of the session the token was issued for
 	jwt.StandardClaims
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Purposes a UserToken can be issued for
+const (
+	TokenPurposeVerifyEmail   = "verifyEmail"
+	TokenPurposeResetPassword = "resetPassword"
+	TokenPurposeTwoFactor     = "twoFactor"
+)
+
+// UserToken is a single-use, expiring token sent to a user to prove they control an email
+// address or to let them choose a new password, or handed out by sign-in while it waits for
+// the user's second factor
+type UserToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"userId"`           // ID of the user the token was issued to
+	Purpose   string             `bson:"purpose"`          // What the token may be used for, one of the TokenPurpose constants
+	Email     string             `bson:"email"`            // Email address the token was sent to
+	TokenHash string             `bson:"tokenHash"`        // SHA-256 of the token; the token itself is never stored
+	CreatedAt time.Time          `bson:"createdAt"`        // Timestamp of when the token was issued
+	ExpiresAt time.Time          `bson:"expiresAt"`        // Timestamp after which the token can no longer be used
+	UsedAt    time.Time          `bson:"usedAt,omitempty"` // Timestamp of when the token was used
+}
@@ -0,0 +1,118 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mySplitBackEnd/models"
+	"time"
+)
+
+// loginTTL is how long a user has to finish signing in at the provider.
+const loginTTL = 10 * time.Minute
+
+// ErrInvalidState is returned when a provider's response does not belong to a sign-in
+// started by BeginLogin, or belongs to one that expired or was already finished.
+var ErrInvalidState = errors.New("invalid or expired sign-in state")
+
+// CreateLoginIndexes makes sure the logins collection can look sign-ins up by state, and has
+// the TTL index that removes them once they have expired.
+func CreateLoginIndexes(ctx context.Context, logins *mongo.Collection) error {
+	_, err := logins.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.M{"stateHash": 1}},
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// BeginLogin starts a sign-in with the provider and returns the URL to send the user to,
+// along with a browser key the browser must keep, in a cookie, to finish the sign-in. The
+// key stops an attacker from getting a victim to finish a sign-in the attacker started.
+func (p *Provider) BeginLogin(ctx context.Context, logins *mongo.Collection) (authURL, browserKey string, err error) {
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	browserKey, err = randomString()
+	if err != nil {
+		return "", "", err
+	}
+	authURL, err = p.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	_, err = logins.InsertOne(ctx, models.OIDCLogin{
+		ID:           primitive.NewObjectID(),
+		Provider:     p.cfg.Name,
+		StateHash:    hashState(state),
+		BrowserHash:  hashState(browserKey),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(loginTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, browserKey, nil
+}
+
+// FinishLogin redeems the code the provider sent back with the state of a sign-in started
+// by BeginLogin in the browser holding browserKey, and returns the claims of the signed-in
+// account. Each sign-in can only be finished once.
+func (p *Provider) FinishLogin(ctx context.Context, logins *mongo.Collection, code, state, browserKey string) (Claims, error) {
+	if browserKey == "" {
+		return Claims{}, ErrInvalidState
+	}
+	now := time.Now()
+	var login models.OIDCLogin
+	err := logins.FindOneAndUpdate(ctx,
+		bson.M{
+			"stateHash":   hashState(state),
+			"browserHash": hashState(browserKey),
+			"provider":    p.cfg.Name,
+			"usedAt":      bson.M{"$exists": false},
+			"expiresAt":   bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"usedAt": now}},
+	).Decode(&login)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Claims{}, ErrInvalidState
+	}
+	if err != nil {
+		return Claims{}, err
+	}
+	return p.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+}
+
+// randomString returns 32 random bytes encoded for use in URLs.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashState returns the form a state or browser key is stored and looked up in.
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
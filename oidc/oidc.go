@@ -0,0 +1,396 @@
+// Package oidc signs users in with an external OpenID Connect provider using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"mySplitBackEnd/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Claims are the parts of an ID token used to find or create the signed-in user.
+type Claims struct {
+	Subject       string // Stable ID of the user at the provider
+	Email         string
+	EmailVerified bool // Whether the provider checked that the user controls Email
+	Name          string
+}
+
+// Provider talks to one OpenID Connect provider. Its endpoints are discovered from the
+// issuer the first time they are needed, so the server starts even when a provider is down.
+type Provider struct {
+	cfg    config.OIDCProvider
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *discovery
+	keys          map[string]interface{} // Verification keys by key ID
+	keysFetchedAt time.Time              // When the keys were last fetched, or tried to be
+	keysFetch     chan struct{}          // Closed when the fetch in progress, if any, finishes
+}
+
+// keysRefetchInterval is how often tokens signed with an unknown key can make the keys be
+// fetched again, so that forged key IDs cannot make every sign-in call the provider.
+const keysRefetchInterval = time.Minute
+
+// discovery is the part of the provider's metadata this package uses.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns a Provider for the configured provider.
+func NewProvider(cfg config.OIDCProvider) *Provider {
+	return &Provider{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// NewProviders returns the configured providers by name.
+func NewProviders(cfgs []config.OIDCProvider) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfgs))
+	for _, cfg := range cfgs {
+		providers[cfg.Name] = NewProvider(cfg)
+	}
+	return providers
+}
+
+// AuthCodeURL returns the provider's URL to send the user to. The state is echoed back to
+// the redirect URL, the nonce ends up in the ID token, and the verifier must be passed to
+// Exchange along with the code.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return d.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of its ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var response struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &response); err != nil && response.Error == "" {
+		return Claims{}, fmt.Errorf("redeeming code: %w", err)
+	}
+	if response.Error != "" {
+		return Claims{}, fmt.Errorf("redeeming code: %s %s", response.Error, response.ErrorDescription)
+	}
+	if response.IDToken == "" {
+		return Claims{}, errors.New("redeeming code: no ID token in response")
+	}
+	return p.Verify(ctx, response.IDToken, nonce)
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce, and returns its claims.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	var claims struct {
+		Nonce         string      `json:"nonce"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"` // Some providers send "true" as a string
+		Name          string      `json:"name"`
+		Audience      audience    `json:"aud"`
+		jwt.StandardClaims
+	}
+	_, err = jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, d, kid)
+	})
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Issuer != d.Issuer {
+		return Claims{}, fmt.Errorf("invalid ID token: issued by %q", claims.Issuer)
+	}
+	if !claims.Audience.contains(p.cfg.ClientID) {
+		return Claims{}, errors.New("invalid ID token: issued for another client")
+	}
+	if claims.ExpiresAt == 0 {
+		return Claims{}, errors.New("invalid ID token: no expiry")
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("invalid ID token: nonce does not match")
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.New("invalid ID token: no subject")
+	}
+
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+	return Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// scopes returns the configured scopes, always including openid.
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 1 {
+		scopes = append(scopes, "email", "profile")
+	}
+	return scopes
+}
+
+// discover fetches and caches the provider's metadata.
+func (p *Provider) discover(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	var d discovery
+	if err := p.doJSON(req, &d); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", p.cfg.Name, err)
+	}
+	if d.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovering %s: issuer %q does not match %q", p.cfg.Name, d.Issuer, p.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: incomplete provider metadata", p.cfg.Name)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// key returns the provider's verification key with the given ID, fetching the provider's
+// keys again when the ID is unknown, as providers rotate their keys, but at most once every
+// keysRefetchInterval.
+func (p *Provider) key(ctx context.Context, d *discovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	if k, ok := p.keys[kid]; ok {
+		p.mu.Unlock()
+		return k, nil
+	}
+	// Wait for a fetch already in progress rather than starting another one
+	if fetch := p.keysFetch; fetch != nil {
+		p.mu.Unlock()
+		select {
+		case <-fetch:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if k, ok := p.keys[kid]; ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if time.Since(p.keysFetchedAt) < keysRefetchInterval {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	fetch := make(chan struct{})
+	p.keysFetch = fetch
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, d)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.keys = keys
+	}
+	p.keysFetch = nil
+	close(fetch)
+	if err != nil {
+		return nil, err
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// fetchKeys downloads the provider's signing keys.
+func (p *Provider) fetchKeys(ctx context.Context, d *discovery) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("fetching keys of %s: %w", p.cfg.Name, err)
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of an unsupported type are skipped rather than failing every sign-in
+		if public, err := k.publicKey(); err == nil {
+			keys[k.Kid] = public
+		}
+	}
+	return keys, nil
+}
+
+// doJSON sends a request and decodes its JSON response. The response is decoded even when
+// the status is not 200, so callers can read error details from it.
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decodeErr := json.NewDecoder(resp.Body).Decode(v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", req.URL.Host, resp.Status)
+	}
+	return decodeErr
+}
+
+// jwk is a public key of the provider in JSON Web Key form.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts an RSA or P-256 key into its Go form.
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// audience is the "aud" claim, which may be a single string or a list of them.
+type audience []string
+
+// UnmarshalJSON accepts both forms of the claim.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// contains reports whether the audience includes the client ID.
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
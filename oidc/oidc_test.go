@@ -0,0 +1,30 @@
+package oidc
+
+import (
+	"context"
+	"mySplitBackEnd/config"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyRefetchesUnknownKeysOnlyOncePerInterval(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Write([]byte(`{"keys": []}`))
+	}))
+	defer server.Close()
+
+	p := NewProvider(config.OIDCProvider{Name: "test"})
+	d := &discovery{JWKSURI: server.URL}
+	for i := 0; i < 3; i++ {
+		if _, err := p.key(context.Background(), d, "forged"); err == nil {
+			t.Fatal("key() found a key the provider does not have")
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("keys were fetched %d times, want 1", n)
+	}
+}
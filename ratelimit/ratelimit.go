@@ -0,0 +1,121 @@
+// Package ratelimit limits how often clients may call an endpoint using token buckets
+// kept in memory or in MongoDB.
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Burst tokens, refilled at Rate tokens a second,
+// and every request takes one.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute returns a limit of n requests a minute, of which up to burst may come at once.
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// PerHour returns a limit of n requests an hour, of which up to burst may come at once.
+func PerHour(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 3600, Burst: burst}
+}
+
+// retryAfter returns how long it takes for a bucket holding tokens to hold one again.
+func (l Limit) retryAfter(tokens float64) time.Duration {
+	if tokens >= 1 || l.Rate <= 0 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+}
+
+// Store keeps the buckets of every key.
+type Store interface {
+	// Take removes a token from the key's bucket. When the bucket is empty it returns false
+	// and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// KeyFunc returns the key of the bucket a request takes its token from. Requests for which
+// it returns an empty key are not limited.
+type KeyFunc func(r *http.Request) string
+
+// Middleware returns a middleware that responds with 429 Too Many Requests and a
+// Retry-After header when the request's bucket is empty. Requests are let through when the
+// store fails, so that an outage of the store does not lock everyone out.
+func Middleware(store Store, name string, limit Limit, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, wait, err := store.Take(r.Context(), name+":"+k, limit)
+			if err != nil {
+				log.Printf("Rate limit store failed for %s: %v", name, err)
+			} else if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too many requests, try again later", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ByIP keys requests by the client's IP address. proxies is the number of reverse proxies
+// in front of the server that append to the X-Forwarded-For header, or 0 to ignore the header.
+// The address is taken that many entries from the right, as entries further left come from
+// the client and can be forged.
+func ByIP(proxies int) KeyFunc {
+	return func(r *http.Request) string {
+		if proxies > 0 {
+			var entries []string
+			for _, value := range r.Header.Values("X-Forwarded-For") {
+				entries = append(entries, strings.Split(value, ",")...)
+			}
+			if len(entries) >= proxies {
+				return strings.TrimSpace(entries[len(entries)-proxies])
+			}
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+}
+
+// ByJSONField keys requests by a string field of their JSON body, such as the email an
+// account signs in with. The body is restored so the handler can still read it.
+func ByJSONField(field string) KeyFunc {
+	return func(r *http.Request) string {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return ""
+		}
+		value, _ := fields[field].(string)
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
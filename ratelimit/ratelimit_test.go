@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestByIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		proxies   int
+		forwarded []string
+		want      string
+	}{
+		{name: "header ignored without proxies", forwarded: []string{"203.0.113.7"}, want: "192.0.2.1"},
+		{name: "one proxy", proxies: 1, forwarded: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "forged entries are skipped", proxies: 1, forwarded: []string{"10.0.0.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "two proxies", proxies: 2, forwarded: []string{"10.0.0.1, 203.0.113.7, 198.51.100.2"}, want: "203.0.113.7"},
+		{name: "several header lines", proxies: 2, forwarded: []string{"10.0.0.1, 203.0.113.7", "198.51.100.2"}, want: "203.0.113.7"},
+		{name: "fewer entries than proxies", proxies: 2, forwarded: []string{"203.0.113.7"}, want: "192.0.2.1"},
+		{name: "no header", proxies: 1, want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/signin", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := ByIP(tt.proxies)(r); got != tt.want {
+				t.Fatalf("ByIP(%d) = %q, want %q", tt.proxies, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByJSONField(t *testing.T) {
+	body := `{"email": " Ada@Example.com ", "password": "secret"}`
+	r := httptest.NewRequest(http.MethodPost, "/api/signin", strings.NewReader(body))
+	if got := ByJSONField("email")(r); got != "ada@example.com" {
+		t.Errorf("key = %q, want ada@example.com", got)
+	}
+	if rest, _ := io.ReadAll(r.Body); string(rest) != body {
+		t.Errorf("body left for the handler = %q", rest)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/signin", strings.NewReader("not json"))
+	if got := ByJSONField("email")(r); got != "" {
+		t.Errorf("key of an invalid body = %q, want none", got)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(1, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, err := store.Take(ctx, "a", limit); err != nil || !allowed {
+			t.Fatalf("request %d was refused: %v", i+1, err)
+		}
+	}
+	allowed, wait, err := store.Take(ctx, "a", limit)
+	if err != nil || allowed {
+		t.Fatalf("request beyond the burst was allowed: %v", err)
+	}
+	if wait <= 0 || wait.Seconds() > 60 {
+		t.Errorf("retry after %v, want up to a minute", wait)
+	}
+	if allowed, _, _ := store.Take(ctx, "b", limit); !allowed {
+		t.Error("another key shares the bucket")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(NewMemoryStore(), "signin", PerHour(1, 1), ByIP(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/signin", nil))
+		return w
+	}
+	if w := serve(); w.Code != http.StatusNoContent {
+		t.Fatalf("first request got %d", w.Code)
+	}
+	w := serve()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request got %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Retry-After = %q, want 3600", w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in memory. Every server process has its own buckets, so it only
+// suits a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), lastSweep: time.Now()}
+}
+
+// Take removes a token from the key's bucket.
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return false, limit.retryAfter(b.tokens), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+// sweep drops the buckets that have refilled completely, as they are the same as new ones.
+// It runs at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// MongoStore keeps buckets in a MongoDB collection so that every server instance shares them.
+// Each bucket is updated with a single atomic update.
+type MongoStore struct {
+	Collection *mongo.Collection
+}
+
+// NewMongoStore returns a MongoStore using the collection, and makes sure it has the TTL
+// index that removes buckets once they have refilled.
+func NewMongoStore(ctx context.Context, collection *mongo.Collection) (*MongoStore, error) {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoStore{Collection: collection}, nil
+}
+
+// Take removes a token from the key's bucket.
+func (s *MongoStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := time.Now()
+	burst := float64(limit.Burst)
+	refilled := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", burst}},
+		bson.M{"$multiply": bson.A{
+			bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}, 1000}},
+			limit.Rate,
+		}},
+	}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"refilled": refilled}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed":   bson.M{"$gte": bson.A{"$refilled", 1}},
+			"tokens":    bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$refilled", 1}}, bson.M{"$subtract": bson.A{"$refilled", 1}}, "$refilled"}},
+			"updatedAt": now,
+			"expiresAt": now.Add(time.Duration(burst / limit.Rate * float64(time.Second))),
+		}}},
+		{{Key: "$unset", Value: "refilled"}},
+	}
+
+	var result struct {
+		Allowed bool    `bson:"allowed"`
+		Tokens  float64 `bson:"tokens"`
+	}
+	err := s.Collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&result)
+	if err != nil {
+		return false, 0, err
+	}
+	if !result.Allowed {
+		return false, limit.retryAfter(result.Tokens), nil
+	}
+	return true, 0, nil
+}
@@ -0,0 +1,138 @@
+// Package settle turns net balances into a short list of payments that settles a group.
+package settle
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"sort"
+)
+
+// Transfer is a single payment of Amount from one user to another.
+type Transfer struct {
+	From   primitive.ObjectID `json:"from"`
+	To     primitive.ObjectID `json:"to"`
+	Amount models.Money       `json:"amount"`
+}
+
+// party is a user with a non-zero outstanding amount in minor units.
+type party struct {
+	userID primitive.ObjectID
+	minor  int64
+}
+
+// Simplify computes the transfers that settle the given net balances.
+// A positive balance means the user is owed money, a negative one means the user owes.
+// Members are considered in order, followed by anyone else with a balance, such as a user
+// who left the group, so that the plan settles every balance. Balances are expected to sum
+// to zero and to be in a single currency, which the transfers are reported in.
+//
+// Pairs of users whose amounts cancel exactly are settled first; the rest is
+// settled greedily by always matching the largest debtor with the
+// largest creditor, so every transfer zeroes at least one of them and a group
+// of n users never needs more than n-1 transfers.
+func Simplify(members []primitive.ObjectID, net map[primitive.ObjectID]models.Money) []Transfer {
+	var debtors, creditors []party
+	var currency string
+	seen := make(map[primitive.ObjectID]bool)
+	for _, userID := range usersOf(members, net) {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		amount := net[userID]
+		if amount.Currency != "" {
+			currency = amount.Currency
+		}
+		switch {
+		case amount.Minor < 0:
+			debtors = append(debtors, party{userID: userID, minor: -amount.Minor})
+		case amount.Minor > 0:
+			creditors = append(creditors, party{userID: userID, minor: amount.Minor})
+		}
+	}
+
+	transfers := []Transfer{}
+
+	// Debtors who owe exactly what a creditor is owed settle in a single payment
+	for i := range debtors {
+		for j := range creditors {
+			if creditors[j].minor != 0 && creditors[j].minor == debtors[i].minor {
+				transfers = append(transfers, Transfer{
+					From:   debtors[i].userID,
+					To:     creditors[j].userID,
+					Amount: models.NewMoney(debtors[i].minor, currency),
+				})
+				debtors[i].minor, creditors[j].minor = 0, 0
+				break
+			}
+		}
+	}
+	debtors, creditors = outstanding(debtors), outstanding(creditors)
+
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sortParties(debtors)
+		sortParties(creditors)
+
+		debtor, creditor := &debtors[0], &creditors[0]
+		minor := debtor.minor
+		if creditor.minor < minor {
+			minor = creditor.minor
+		}
+		transfers = append(transfers, Transfer{
+			From:   debtor.userID,
+			To:     creditor.userID,
+			Amount: models.NewMoney(minor, currency),
+		})
+
+		debtor.minor -= minor
+		creditor.minor -= minor
+		if debtor.minor == 0 {
+			debtors = debtors[1:]
+		}
+		if creditor.minor == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
+
+// usersOf lists the members followed by the other users with a balance, in a stable order.
+func usersOf(members []primitive.ObjectID, net map[primitive.ObjectID]models.Money) []primitive.ObjectID {
+	isMember := make(map[primitive.ObjectID]bool, len(members))
+	for _, userID := range members {
+		isMember[userID] = true
+	}
+	var others []primitive.ObjectID
+	for userID := range net {
+		if !isMember[userID] {
+			others = append(others, userID)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Hex() < others[j].Hex()
+	})
+	return append(append([]primitive.ObjectID{}, members...), others...)
+}
+
+// sortParties orders parties by outstanding amount, largest first, breaking ties by user ID
+// so that the same balances always produce the same plan.
+func sortParties(parties []party) {
+	sort.Slice(parties, func(i, j int) bool {
+		if parties[i].minor != parties[j].minor {
+			return parties[i].minor > parties[j].minor
+		}
+		return parties[i].userID.Hex() < parties[j].userID.Hex()
+	})
+}
+
+// outstanding drops parties that are already settled.
+func outstanding(parties []party) []party {
+	remaining := parties[:0]
+	for _, p := range parties {
+		if p.minor != 0 {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,115 @@
+package settle
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"reflect"
+	"testing"
+)
+
+// user returns a fixed ObjectID, so that ties are broken in a known order.
+func user(n byte) primitive.ObjectID {
+	return primitive.ObjectID{11: n}
+}
+
+func eur(minor int64) models.Money {
+	return models.NewMoney(minor, "EUR")
+}
+
+func TestSimplify(t *testing.T) {
+	a, b, c, d, left := user(1), user(2), user(3), user(4), user(9)
+
+	tests := []struct {
+		name    string
+		members []primitive.ObjectID
+		net     map[primitive.ObjectID]models.Money
+		want    []Transfer
+	}{
+		{
+			name:    "settled group",
+			members: []primitive.ObjectID{a, b},
+			net:     map[primitive.ObjectID]models.Money{a: eur(0), b: eur(0)},
+			want:    []Transfer{},
+		},
+		{
+			name:    "exact matches settle in one payment each",
+			members: []primitive.ObjectID{a, b, c, d},
+			net:     map[primitive.ObjectID]models.Money{a: eur(-1000), b: eur(500), c: eur(-500), d: eur(1000)},
+			want: []Transfer{
+				{From: a, To: d, Amount: eur(1000)},
+				{From: c, To: b, Amount: eur(500)},
+			},
+		},
+		{
+			name:    "largest debtor pays largest creditor first",
+			members: []primitive.ObjectID{a, b, c, d},
+			net:     map[primitive.ObjectID]models.Money{a: eur(5000), b: eur(3000), c: eur(-4000), d: eur(-4000)},
+			want: []Transfer{
+				{From: c, To: a, Amount: eur(4000)},
+				{From: d, To: b, Amount: eur(3000)},
+				{From: d, To: a, Amount: eur(1000)},
+			},
+		},
+		{
+			name:    "uneven minor units are settled to the last unit",
+			members: []primitive.ObjectID{a, b, c},
+			net:     map[primitive.ObjectID]models.Money{a: models.NewMoney(667, "JPY"), b: models.NewMoney(-334, "JPY"), c: models.NewMoney(-333, "JPY")},
+			want: []Transfer{
+				{From: b, To: a, Amount: models.NewMoney(334, "JPY")},
+				{From: c, To: a, Amount: models.NewMoney(333, "JPY")},
+			},
+		},
+		{
+			name:    "balances of users who left are settled too",
+			members: []primitive.ObjectID{a, b},
+			net:     map[primitive.ObjectID]models.Money{a: eur(1500), b: eur(-500), left: eur(-1000)},
+			want: []Transfer{
+				{From: left, To: a, Amount: eur(1000)},
+				{From: b, To: a, Amount: eur(500)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Simplify(tt.members, tt.net)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Simplify() = %v, want %v", got, tt.want)
+			}
+			assertSettles(t, tt.net, got)
+		})
+	}
+}
+
+func TestSimplifyNeedsFewerTransfersThanUsers(t *testing.T) {
+	members := []primitive.ObjectID{user(1), user(2), user(3), user(4), user(5)}
+	net := map[primitive.ObjectID]models.Money{
+		user(1): eur(-1234), user(2): eur(-4321), user(3): eur(2000), user(4): eur(2555), user(5): eur(1000),
+	}
+	got := Simplify(members, net)
+	if len(got) > len(members)-1 {
+		t.Fatalf("Simplify() made %d transfers for %d users", len(got), len(members))
+	}
+	assertSettles(t, net, got)
+}
+
+// assertSettles checks that applying the transfers brings every balance to zero.
+func assertSettles(t *testing.T, net map[primitive.ObjectID]models.Money, transfers []Transfer) {
+	t.Helper()
+	remaining := make(map[primitive.ObjectID]int64)
+	for userID, amount := range net {
+		remaining[userID] = amount.Minor
+	}
+	for _, transfer := range transfers {
+		if transfer.Amount.Minor <= 0 {
+			t.Errorf("transfer %v is not positive", transfer)
+		}
+		remaining[transfer.From] += transfer.Amount.Minor
+		remaining[transfer.To] -= transfer.Amount.Minor
+	}
+	for userID, minor := range remaining {
+		if minor != 0 {
+			t.Errorf("user %s is left with %d", userID.Hex(), minor)
+		}
+	}
+}
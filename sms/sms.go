@@ -0,0 +1,71 @@
+// Package sms sends the text messages the server needs, such as one-time sign-in codes.
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SMSSender delivers text messages to mobile numbers.
+type SMSSender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// HTTPSender delivers text messages through an SMS gateway that takes them as a JSON object
+// with "from", "to" and "body" fields posted to its URL, authenticating with a bearer token
+// when one is set.
+type HTTPSender struct {
+	URL    string // Endpoint of the gateway messages are posted to
+	Token  string // Bearer token of the gateway account
+	From   string // Sender number or name the messages come from
+	Client *http.Client
+}
+
+// Send posts the message to the gateway and fails unless it answers with a 2xx status.
+func (s *HTTPSender) Send(ctx context.Context, to, body string) error {
+	payload, err := json.Marshal(struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+		Body string `json:"body"`
+	}{s.From, to, body})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("SMS gateway answered %s", resp.Status)
+	}
+	return nil
+}
+
+// LogSender writes text messages to the standard logger instead of sending them. It is
+// only meant for development, as the logs then hold sign-in codes and invitation links.
+type LogSender struct{}
+
+// Send records the message.
+func (LogSender) Send(ctx context.Context, to, body string) error {
+	log.Printf("sms to %s: %s", to, body)
+	return nil
+}
@@ -0,0 +1,53 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		wantErr bool
+	}{
+		{name: "delivered", token: "secret", status: http.StatusAccepted},
+		{name: "without a token", status: http.StatusOK},
+		{name: "refused", token: "secret", status: http.StatusUnauthorized, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message map[string]string
+			var authorization string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authorization = r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&message)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			sender := &HTTPSender{URL: server.URL, Token: tt.token, From: "mySplit"}
+			err := sender.Send(context.Background(), "+15550100", "Your code is 123456")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() = %v, want an error: %v", err, tt.wantErr)
+			}
+			want := map[string]string{"from": "mySplit", "to": "+15550100", "body": "Your code is 123456"}
+			for field, value := range want {
+				if message[field] != value {
+					t.Errorf("gateway got %s = %q, want %q", field, message[field], value)
+				}
+			}
+			wantAuthorization := ""
+			if tt.token != "" {
+				wantAuthorization = "Bearer " + tt.token
+			}
+			if authorization != wantAuthorization {
+				t.Errorf("Authorization = %q, want %q", authorization, wantAuthorization)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Package split computes how an expense amount is divided among its participants.
+package split
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"mySplitBackEnd/models"
+)
+
+// Mode is a strategy for dividing an expense among its participants.
+type Mode string
+
+const (
+	ModeEqual      Mode = "equal"      // Everyone pays the same; participant values are ignored
+	ModeExact      Mode = "exact"      // Values are the exact amount each participant owes
+	ModePercentage Mode = "percentage" // Values are percentages of the amount and must sum to 100
+	ModeShares     Mode = "shares"     // Values are weights, e.g. 2 shares pays twice as much as 1
+	ModeItemized   Mode = "itemized"   // The split is derived from the expense's line items, see Itemize
+)
+
+// Valid reports whether the mode is one of the supported split strategies.
+func (m Mode) Valid() bool {
+	switch m {
+	case ModeEqual, ModeExact, ModePercentage, ModeShares, ModeItemized:
+		return true
+	}
+	return false
+}
+
+// Compute divides amount among participants according to mode.
+// Minor units that cannot be divided evenly are handed out one at a time, first to the
+// participants with the largest rounding loss and then in participant order, so the
+// returned splits always sum exactly to amount.
+func Compute(amount models.Money, mode Mode, participants []models.SplitParticipant) ([]models.ExpenseSplit, error) {
+	if !mode.Valid() {
+		return nil, fmt.Errorf("unknown split mode %q", mode)
+	}
+	if mode == ModeItemized {
+		return nil, errors.New("itemized splits are computed from items")
+	}
+	if len(participants) == 0 {
+		return nil, errors.New("at least one participant is required")
+	}
+	total := amount.Minor
+	if total <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+	seen := make(map[primitive.ObjectID]bool)
+	for _, p := range participants {
+		if p.UserID == primitive.NilObjectID {
+			return nil, errors.New("participant userId is required")
+		}
+		if seen[p.UserID] {
+			return nil, fmt.Errorf("participant %s is listed more than once", p.UserID.Hex())
+		}
+		seen[p.UserID] = true
+		if mode != ModeEqual && p.Value < 0 {
+			return nil, fmt.Errorf("participant %s has a negative value", p.UserID.Hex())
+		}
+	}
+
+	var minor []int64
+	switch mode {
+	case ModeEqual:
+		weights := make([]float64, len(participants))
+		for i := range weights {
+			weights[i] = 1
+		}
+		minor = Allocate(total, weights)
+	case ModeExact:
+		var sum int64
+		minor = make([]int64, len(participants))
+		for i, p := range participants {
+			minor[i] = models.MoneyFromMajor(p.Value, amount.Currency).Minor
+			sum += minor[i]
+		}
+		if sum != total {
+			return nil, fmt.Errorf("exact amounts sum to %s but the expense amount is %s",
+				models.NewMoney(sum, amount.Currency), amount)
+		}
+	case ModePercentage:
+		var sum float64
+		for _, p := range participants {
+			sum += p.Value
+		}
+		if math.Abs(sum-100) > 1e-6 {
+			return nil, fmt.Errorf("percentages sum to %g, not 100", sum)
+		}
+		minor = Allocate(total, values(participants))
+	case ModeShares:
+		var sum float64
+		for _, p := range participants {
+			sum += p.Value
+		}
+		if sum <= 0 {
+			return nil, errors.New("shares must add up to more than zero")
+		}
+		minor = Allocate(total, values(participants))
+	}
+
+	splits := make([]models.ExpenseSplit, len(participants))
+	for i, p := range participants {
+		splits[i] = models.ExpenseSplit{UserID: p.UserID, Amount: models.NewMoney(minor[i], amount.Currency)}
+	}
+	return splits, nil
+}
+
+// Allocate divides total minor units proportionally to weights using the largest remainder method.
+func Allocate(total int64, weights []float64) []int64 {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+
+	minor := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		minor[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(minor[i])
+		allocated += minor[i]
+	}
+
+	// Hand out the leftover units, largest remainder first, earlier participants winning ties
+	for leftover := total - allocated; leftover > 0; leftover-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best]+1e-9 {
+				best = i
+			}
+		}
+		minor[best]++
+		remainders[best] = -1
+	}
+	return minor
+}
+
+// values returns the participants' values in order.
+func values(participants []models.SplitParticipant) []float64 {
+	v := make([]float64, len(participants))
+	for i, p := range participants {
+		v[i] = p.Value
+	}
+	return v
+}
+
+// Itemize splits an itemized receipt. Each item is shared equally by its participants,
+// and tax and tip are shared in proportion to what each user had, so the returned splits
+// always sum exactly to the items plus tax and tip, which is returned as the total.
+// Users appear in the order they are first listed on an item.
+func Itemize(items []models.ExpenseItem, tax, tip models.Money) ([]models.ExpenseSplit, models.Money, error) {
+	if len(items) == 0 {
+		return nil, models.Money{}, errors.New("at least one item is required")
+	}
+	if tax.Minor < 0 || tip.Minor < 0 {
+		return nil, models.Money{}, errors.New("tax and tip must not be negative")
+	}
+
+	currency := items[0].Amount.Currency
+	var order []primitive.ObjectID
+	subtotals := make(map[primitive.ObjectID]int64)
+	var subtotal int64
+	for i, item := range items {
+		if item.Amount.Minor < 0 {
+			return nil, models.Money{}, fmt.Errorf("item %d (%s) has a negative amount", i, item.Name)
+		}
+		if item.Amount.Currency != currency {
+			return nil, models.Money{}, fmt.Errorf("item %d (%s) is not in %s like the other items", i, item.Name, currency)
+		}
+		if len(item.Participants) == 0 {
+			return nil, models.Money{}, fmt.Errorf("item %d (%s) has no participants", i, item.Name)
+		}
+		seen := make(map[primitive.ObjectID]bool)
+		weights := make([]float64, len(item.Participants))
+		for j, userID := range item.Participants {
+			if userID == primitive.NilObjectID {
+				return nil, models.Money{}, fmt.Errorf("item %d (%s) has a participant without a userId", i, item.Name)
+			}
+			if seen[userID] {
+				return nil, models.Money{}, fmt.Errorf("item %d (%s) lists participant %s more than once", i, item.Name, userID.Hex())
+			}
+			seen[userID] = true
+			weights[j] = 1
+		}
+		for j, minor := range Allocate(item.Amount.Minor, weights) {
+			userID := item.Participants[j]
+			if _, ok := subtotals[userID]; !ok {
+				order = append(order, userID)
+			}
+			subtotals[userID] += minor
+		}
+		subtotal += item.Amount.Minor
+	}
+
+	if (!tax.IsZero() && tax.Currency != currency) || (!tip.IsZero() && tip.Currency != currency) {
+		return nil, models.Money{}, fmt.Errorf("tax and tip must be in %s like the items", currency)
+	}
+	extras := tax.Minor + tip.Minor
+	if extras > 0 && subtotal == 0 {
+		return nil, models.Money{}, errors.New("tax and tip cannot be shared when the items are free")
+	}
+	weights := make([]float64, len(order))
+	for i, userID := range order {
+		weights[i] = float64(subtotals[userID])
+	}
+	shared := make([]int64, len(order))
+	if extras > 0 {
+		shared = Allocate(extras, weights)
+	}
+
+	splits := make([]models.ExpenseSplit, len(order))
+	for i, userID := range order {
+		splits[i] = models.ExpenseSplit{UserID: userID, Amount: models.NewMoney(subtotals[userID]+shared[i], currency)}
+	}
+	return splits, models.NewMoney(subtotal+extras, currency), nil
+}
@@ -0,0 +1,256 @@
+package split
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"reflect"
+	"testing"
+)
+
+// user returns a fixed ObjectID for test participants.
+func user(n byte) primitive.ObjectID {
+	return primitive.ObjectID{11: n}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int64
+		weights []float64
+		want    []int64
+	}{
+		{name: "even", total: 900, weights: []float64{1, 1, 1}, want: []int64{300, 300, 300}},
+		{name: "leftover goes to earlier participants on ties", total: 100, weights: []float64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "leftover goes to the largest remainder", total: 10, weights: []float64{1, 2, 3}, want: []int64{2, 3, 5}},
+		{name: "zero weight gets nothing", total: 500, weights: []float64{1, 0, 1}, want: []int64{250, 0, 250}},
+		{name: "single participant", total: 777, weights: []float64{0.5}, want: []int64{777}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.total, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Allocate(%d, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	a, b, c := user(1), user(2), user(3)
+	eur := func(minor int64) models.Money { return models.NewMoney(minor, "EUR") }
+
+	tests := []struct {
+		name         string
+		amount       models.Money
+		mode         Mode
+		participants []models.SplitParticipant
+		want         []int64
+		wantErr      bool
+	}{
+		{
+			name:         "equal ignores values",
+			amount:       eur(1000),
+			mode:         ModeEqual,
+			participants: []models.SplitParticipant{{UserID: a, Value: 5}, {UserID: b}, {UserID: c}},
+			want:         []int64{334, 333, 333},
+		},
+		{
+			name:         "exact amounts in major units",
+			amount:       eur(1000),
+			mode:         ModeExact,
+			participants: []models.SplitParticipant{{UserID: a, Value: 2.5}, {UserID: b, Value: 7.5}},
+			want:         []int64{250, 750},
+		},
+		{
+			name:         "exact amounts in a currency without decimals",
+			amount:       models.NewMoney(1000, "JPY"),
+			mode:         ModeExact,
+			participants: []models.SplitParticipant{{UserID: a, Value: 400}, {UserID: b, Value: 600}},
+			want:         []int64{400, 600},
+		},
+		{
+			name:         "exact amounts must add up",
+			amount:       eur(1000),
+			mode:         ModeExact,
+			participants: []models.SplitParticipant{{UserID: a, Value: 2.5}, {UserID: b, Value: 7}},
+			wantErr:      true,
+		},
+		{
+			name:         "percentages",
+			amount:       eur(1001),
+			mode:         ModePercentage,
+			participants: []models.SplitParticipant{{UserID: a, Value: 50}, {UserID: b, Value: 50}},
+			want:         []int64{501, 500},
+		},
+		{
+			name:         "percentages must add up to 100",
+			amount:       eur(1000),
+			mode:         ModePercentage,
+			participants: []models.SplitParticipant{{UserID: a, Value: 50}, {UserID: b, Value: 40}},
+			wantErr:      true,
+		},
+		{
+			name:         "shares",
+			amount:       eur(1000),
+			mode:         ModeShares,
+			participants: []models.SplitParticipant{{UserID: a, Value: 3}, {UserID: b, Value: 1}},
+			want:         []int64{750, 250},
+		},
+		{
+			name:         "shares must not all be zero",
+			amount:       eur(1000),
+			mode:         ModeShares,
+			participants: []models.SplitParticipant{{UserID: a}, {UserID: b}},
+			wantErr:      true,
+		},
+		{
+			name:         "negative values",
+			amount:       eur(1000),
+			mode:         ModeShares,
+			participants: []models.SplitParticipant{{UserID: a, Value: -1}, {UserID: b, Value: 2}},
+			wantErr:      true,
+		},
+		{
+			name:         "duplicate participants",
+			amount:       eur(1000),
+			mode:         ModeEqual,
+			participants: []models.SplitParticipant{{UserID: a}, {UserID: a}},
+			wantErr:      true,
+		},
+		{name: "no participants", amount: eur(1000), mode: ModeEqual, wantErr: true},
+		{name: "unknown mode", amount: eur(1000), mode: "thirds", participants: []models.SplitParticipant{{UserID: a}}, wantErr: true},
+		{name: "itemized", amount: eur(1000), mode: ModeItemized, participants: []models.SplitParticipant{{UserID: a}}, wantErr: true},
+		{name: "zero amount", amount: eur(0), mode: ModeEqual, participants: []models.SplitParticipant{{UserID: a}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splits, err := Compute(tt.amount, tt.mode, tt.participants)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Compute() = %v, want an error", splits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int64, len(splits))
+			for i, s := range splits {
+				got[i] = s.Amount.Minor
+				if s.UserID != tt.participants[i].UserID {
+					t.Errorf("split %d is for %s, want %s", i, s.UserID.Hex(), tt.participants[i].UserID.Hex())
+				}
+				if s.Amount.Currency != tt.amount.Currency {
+					t.Errorf("split %d is in %q, want %q", i, s.Amount.Currency, tt.amount.Currency)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Compute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestItemize(t *testing.T) {
+	a, b, c := user(1), user(2), user(3)
+	eur := func(minor int64) models.Money { return models.NewMoney(minor, "EUR") }
+
+	tests := []struct {
+		name      string
+		items     []models.ExpenseItem
+		tax, tip  models.Money
+		want      map[primitive.ObjectID]int64
+		wantOrder []primitive.ObjectID
+		wantTotal int64
+		wantErr   bool
+	}{
+		{
+			name: "items shared equally",
+			items: []models.ExpenseItem{
+				{Name: "Pizza", Amount: eur(1001), Participants: []primitive.ObjectID{a, b}},
+				{Name: "Salad", Amount: eur(700), Participants: []primitive.ObjectID{c}},
+			},
+			want:      map[primitive.ObjectID]int64{a: 501, b: 500, c: 700},
+			wantOrder: []primitive.ObjectID{a, b, c},
+			wantTotal: 1701,
+		},
+		{
+			name: "tax and tip in proportion to items",
+			items: []models.ExpenseItem{
+				{Name: "Steak", Amount: eur(3000), Participants: []primitive.ObjectID{b}},
+				{Name: "Soup", Amount: eur(1000), Participants: []primitive.ObjectID{a}},
+			},
+			tax:       eur(400),
+			tip:       eur(201),
+			want:      map[primitive.ObjectID]int64{b: 3451, a: 1150},
+			wantOrder: []primitive.ObjectID{b, a},
+			wantTotal: 4601,
+		},
+		{
+			name:    "no items",
+			wantErr: true,
+		},
+		{
+			name:    "item without participants",
+			items:   []models.ExpenseItem{{Name: "Bread", Amount: eur(300)}},
+			wantErr: true,
+		},
+		{
+			name:    "participant listed twice",
+			items:   []models.ExpenseItem{{Name: "Bread", Amount: eur(300), Participants: []primitive.ObjectID{a, a}}},
+			wantErr: true,
+		},
+		{
+			name: "items in different currencies",
+			items: []models.ExpenseItem{
+				{Name: "Bread", Amount: eur(300), Participants: []primitive.ObjectID{a}},
+				{Name: "Wine", Amount: models.NewMoney(300, "USD"), Participants: []primitive.ObjectID{a}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "negative tip",
+			items:   []models.ExpenseItem{{Name: "Bread", Amount: eur(300), Participants: []primitive.ObjectID{a}}},
+			tip:     eur(-50),
+			wantErr: true,
+		},
+		{
+			name:    "tax on free items",
+			items:   []models.ExpenseItem{{Name: "Water", Amount: eur(0), Participants: []primitive.ObjectID{a}}},
+			tax:     eur(10),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			splits, total, err := Itemize(tt.items, tt.tax, tt.tip)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Itemize() = %v, want an error", splits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != eur(tt.wantTotal) {
+				t.Errorf("total = %v, want %v", total, eur(tt.wantTotal))
+			}
+			var sum int64
+			for i, s := range splits {
+				if s.UserID != tt.wantOrder[i] {
+					t.Errorf("split %d is for %s, want %s", i, s.UserID.Hex(), tt.wantOrder[i].Hex())
+				}
+				if s.Amount.Minor != tt.want[s.UserID] {
+					t.Errorf("split of %s = %d, want %d", s.UserID.Hex(), s.Amount.Minor, tt.want[s.UserID])
+				}
+				sum += s.Amount.Minor
+			}
+			if sum != total.Minor {
+				t.Errorf("splits sum to %d, want %d", sum, total.Minor)
+			}
+		})
+	}
+}
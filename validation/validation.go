@@ -0,0 +1,184 @@
+// Package validation checks documents against the rest of the data they reference
+// and reports problems field by field.
+package validation
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"mySplitBackEnd/split"
+	"strings"
+)
+
+// FieldError describes a problem with a single field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of problems found while validating a document.
+type Errors []FieldError
+
+// Error joins the field errors into a single message.
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// add records a problem with a field.
+func (e *Errors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateExpense checks that an expense is consistent with the group it belongs to:
+// the payers and every user in the split must be members, its category must be one of the
+// group's categories, and both the payer and the split amounts must sum exactly to the
+// expense amount. It returns nil when the expense is valid.
+func ValidateExpense(expense models.Expense, group models.Group) Errors {
+	var errs Errors
+
+	members := make(map[primitive.ObjectID]bool, len(group.Users))
+	for _, userID := range group.Users {
+		members[userID] = true
+	}
+
+	if expense.GroupID != group.ID {
+		errs.add("GroupID", "does not match the group %s", group.ID.Hex())
+	}
+	if expense.Amount.Minor <= 0 {
+		errs.add("Amount", "must be greater than zero")
+	}
+	if len(expense.Payers) == 0 {
+		if expense.PaidBy == primitive.NilObjectID {
+			errs.add("PaidBy", "is required")
+		} else if !members[expense.PaidBy] {
+			errs.add("PaidBy", "user %s is not a member of the group", expense.PaidBy.Hex())
+		}
+	} else {
+		validatePayers(&errs, expense, members)
+	}
+	if expense.CreatedBy != primitive.NilObjectID && !members[expense.CreatedBy] {
+		errs.add("CreatedBy", "user %s is not a member of the group", expense.CreatedBy.Hex())
+	}
+	if expense.Category != "" && len(group.Settings.Categories) > 0 && !contains(group.Settings.Categories, expense.Category) {
+		errs.add("Category", "%q is not one of the group's categories", expense.Category)
+	}
+
+	if len(expense.Split) == 0 {
+		errs.add("Split", "must contain at least one user")
+		return errs
+	}
+	var total int64
+	seen := make(map[primitive.ObjectID]bool, len(expense.Split))
+	for i, split := range expense.Split {
+		field := fmt.Sprintf("Split[%d]", i)
+		switch {
+		case split.UserID == primitive.NilObjectID:
+			errs.add(field+".UserID", "is required")
+		case !members[split.UserID]:
+			errs.add(field+".UserID", "user %s is not a member of the group", split.UserID.Hex())
+		case seen[split.UserID]:
+			errs.add(field+".UserID", "user %s appears more than once", split.UserID.Hex())
+		}
+		seen[split.UserID] = true
+		if split.Amount.Minor < 0 {
+			errs.add(field+".Amount", "must not be negative")
+		}
+		if split.Amount.Currency != expense.Amount.Currency {
+			errs.add(field+".Amount", "currency %q does not match the expense currency %q", split.Amount.Currency, expense.Amount.Currency)
+		}
+		total += split.Amount.Minor
+	}
+	if total != expense.Amount.Minor {
+		errs.add("Split", "amounts sum to %s but the expense amount is %s", models.NewMoney(total, expense.Amount.Currency), expense.Amount)
+	}
+
+	return errs
+}
+
+// validatePayers checks that every payer is a distinct group member and that together
+// they paid exactly the expense amount.
+func validatePayers(errs *Errors, expense models.Expense, members map[primitive.ObjectID]bool) {
+	var total int64
+	seen := make(map[primitive.ObjectID]bool, len(expense.Payers))
+	for i, payer := range expense.Payers {
+		field := fmt.Sprintf("Payers[%d]", i)
+		switch {
+		case payer.UserID == primitive.NilObjectID:
+			errs.add(field+".UserID", "is required")
+		case !members[payer.UserID]:
+			errs.add(field+".UserID", "user %s is not a member of the group", payer.UserID.Hex())
+		case seen[payer.UserID]:
+			errs.add(field+".UserID", "user %s appears more than once", payer.UserID.Hex())
+		}
+		seen[payer.UserID] = true
+		if payer.Amount.Minor < 0 {
+			errs.add(field+".Amount", "must not be negative")
+		}
+		if payer.Amount.Currency != expense.Amount.Currency {
+			errs.add(field+".Amount", "currency %q does not match the expense currency %q", payer.Amount.Currency, expense.Amount.Currency)
+		}
+		total += payer.Amount.Minor
+	}
+	if total != expense.Amount.Minor {
+		errs.add("Payers", "amounts sum to %s but the expense amount is %s", models.NewMoney(total, expense.Amount.Currency), expense.Amount)
+	}
+}
+
+// ValidateGroupSettings checks that a group's settings are usable: the default currency must
+// be an ISO 4217 code, the default split mode one that needs no amounts, and the default
+// participants distinct members whose percentages or shares that mode can split by.
+func ValidateGroupSettings(settings models.GroupSettings, group models.Group) Errors {
+	var errs Errors
+
+	if settings.DefaultCurrency != "" && !models.IsCurrency(settings.DefaultCurrency) {
+		errs.add("DefaultCurrency", "must be an ISO 4217 currency code")
+	}
+	mode := split.Mode(settings.DefaultSplitMode)
+	switch mode {
+	case "":
+		mode = split.ModeEqual
+	case split.ModeEqual, split.ModePercentage, split.ModeShares:
+	default:
+		errs.add("DefaultSplitMode", "must be equal, percentage or shares")
+		return errs
+	}
+
+	members := make(map[primitive.ObjectID]bool, len(group.Users))
+	for _, userID := range group.Users {
+		members[userID] = true
+	}
+	seen := make(map[primitive.ObjectID]bool, len(settings.DefaultParticipants))
+	for i, p := range settings.DefaultParticipants {
+		field := fmt.Sprintf("DefaultParticipants[%d].UserID", i)
+		switch {
+		case !members[p.UserID]:
+			errs.add(field, "user %s is not a member of the group", p.UserID.Hex())
+		case seen[p.UserID]:
+			errs.add(field, "user %s appears more than once", p.UserID.Hex())
+		}
+		seen[p.UserID] = true
+	}
+	if len(settings.DefaultParticipants) == 0 && mode == split.ModePercentage {
+		errs.add("DefaultParticipants", "are required to split by percentage")
+	} else if len(settings.DefaultParticipants) > 0 {
+		// Splitting a sample amount catches percentages that do not add up and similar mistakes
+		if _, err := split.Compute(models.NewMoney(10000, group.Currency), mode, settings.DefaultParticipants); err != nil {
+			errs.add("DefaultParticipants", "%s", err.Error())
+		}
+	}
+	return errs
+}
+
+// contains reports whether values includes value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
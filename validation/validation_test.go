@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mySplitBackEnd/models"
+	"reflect"
+	"testing"
+)
+
+// user returns a fixed ObjectID for test members.
+func user(n byte) primitive.ObjectID {
+	return primitive.ObjectID{11: n}
+}
+
+func eur(minor int64) models.Money {
+	return models.NewMoney(minor, "EUR")
+}
+
+// fields lists the fields the errors are about, in order.
+func fields(errs Errors) []string {
+	result := []string{}
+	for _, e := range errs {
+		result = append(result, e.Field)
+	}
+	return result
+}
+
+func TestValidateExpense(t *testing.T) {
+	a, b, stranger := user(1), user(2), user(9)
+	group := models.Group{ID: user(100), Users: []primitive.ObjectID{a, b}, Currency: "EUR"}
+	valid := func() models.Expense {
+		return models.Expense{
+			GroupID:   group.ID,
+			PaidBy:    a,
+			CreatedBy: a,
+			Amount:    eur(1000),
+			Split:     []models.ExpenseSplit{{UserID: a, Amount: eur(500)}, {UserID: b, Amount: eur(500)}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(e *models.Expense)
+		want   []string
+	}{
+		{name: "valid", change: func(e *models.Expense) {}, want: []string{}},
+		{name: "other group", change: func(e *models.Expense) { e.GroupID = user(101) }, want: []string{"GroupID"}},
+		{
+			name: "zero amount",
+			change: func(e *models.Expense) {
+				e.Amount = eur(0)
+				e.Split = []models.ExpenseSplit{{UserID: a, Amount: eur(0)}}
+			},
+			want: []string{"Amount"},
+		},
+		{name: "no payer", change: func(e *models.Expense) { e.PaidBy = primitive.NilObjectID }, want: []string{"PaidBy"}},
+		{name: "payer outside the group", change: func(e *models.Expense) { e.PaidBy = stranger }, want: []string{"PaidBy"}},
+		{name: "creator outside the group", change: func(e *models.Expense) { e.CreatedBy = stranger }, want: []string{"CreatedBy"}},
+		{name: "empty split", change: func(e *models.Expense) { e.Split = nil }, want: []string{"Split"}},
+		{name: "split outside the group", change: func(e *models.Expense) { e.Split[1].UserID = stranger }, want: []string{"Split[1].UserID"}},
+		{name: "split lists a user twice", change: func(e *models.Expense) { e.Split[1].UserID = a }, want: []string{"Split[1].UserID"}},
+		{
+			name: "negative share",
+			change: func(e *models.Expense) {
+				e.Split[0].Amount = eur(-500)
+				e.Split[1].Amount = eur(1500)
+			},
+			want: []string{"Split[0].Amount"},
+		},
+		{name: "share in another currency", change: func(e *models.Expense) { e.Split[1].Amount = models.NewMoney(500, "USD") }, want: []string{"Split[1].Amount"}},
+		{name: "split does not add up", change: func(e *models.Expense) { e.Split[1].Amount = eur(499) }, want: []string{"Split"}},
+		{
+			name: "several payers",
+			change: func(e *models.Expense) {
+				e.Payers = []models.Payer{{UserID: a, Amount: eur(300)}, {UserID: b, Amount: eur(700)}}
+			},
+			want: []string{},
+		},
+		{
+			name: "payer outside the group",
+			change: func(e *models.Expense) {
+				e.Payers = []models.Payer{{UserID: a, Amount: eur(300)}, {UserID: stranger, Amount: eur(700)}}
+			},
+			want: []string{"Payers[1].UserID"},
+		},
+		{
+			name: "payer listed twice",
+			change: func(e *models.Expense) {
+				e.Payers = []models.Payer{{UserID: a, Amount: eur(300)}, {UserID: a, Amount: eur(700)}}
+			},
+			want: []string{"Payers[1].UserID"},
+		},
+		{
+			name: "payments do not add up",
+			change: func(e *models.Expense) {
+				e.Payers = []models.Payer{{UserID: a, Amount: eur(300)}, {UserID: b, Amount: eur(600)}}
+			},
+			want: []string{"Payers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expense := valid()
+			tt.change(&expense)
+			got := fields(ValidateExpense(expense, group))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ValidateExpense() reported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorsError(t *testing.T) {
+	errs := Errors{{Field: "Amount", Message: "must be greater than zero"}, {Field: "PaidBy", Message: "is required"}}
+	want := "Amount: must be greater than zero; PaidBy: is required"
+	if got := errs.Error(); got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateGroupSettings(t *testing.T) {
+	a, b, stranger := user(1), user(2), user(9)
+	group := models.Group{ID: user(100), Users: []primitive.ObjectID{a, b}, Currency: "EUR"}
+
+	tests := []struct {
+		name     string
+		settings models.GroupSettings
+		want     []string
+	}{
+		{name: "no settings", want: []string{}},
+		{
+			name:     "shares",
+			settings: models.GroupSettings{DefaultCurrency: "USD", DefaultSplitMode: "shares", DefaultParticipants: []models.SplitParticipant{{UserID: a, Value: 2}, {UserID: b, Value: 1}}},
+			want:     []string{},
+		},
+		{name: "currency", settings: models.GroupSettings{DefaultCurrency: "EURO"}, want: []string{"DefaultCurrency"}},
+		{name: "unknown currency", settings: models.GroupSettings{DefaultCurrency: "USX"}, want: []string{"DefaultCurrency"}},
+		{name: "mode that needs amounts", settings: models.GroupSettings{DefaultSplitMode: "exact"}, want: []string{"DefaultSplitMode"}},
+		{name: "percentages without participants", settings: models.GroupSettings{DefaultSplitMode: "percentage"}, want: []string{"DefaultParticipants"}},
+		{
+			name:     "percentages that do not add up",
+			settings: models.GroupSettings{DefaultSplitMode: "percentage", DefaultParticipants: []models.SplitParticipant{{UserID: a, Value: 50}, {UserID: b, Value: 40}}},
+			want:     []string{"DefaultParticipants"},
+		},
+		{
+			name:     "participant outside the group",
+			settings: models.GroupSettings{DefaultParticipants: []models.SplitParticipant{{UserID: a}, {UserID: stranger}}},
+			want:     []string{"DefaultParticipants[1].UserID"},
+		},
+		{
+			name:     "participant listed twice",
+			settings: models.GroupSettings{DefaultParticipants: []models.SplitParticipant{{UserID: a}, {UserID: a}}},
+			want:     []string{"DefaultParticipants[1].UserID", "DefaultParticipants"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fields(ValidateGroupSettings(tt.settings, group))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ValidateGroupSettings() reported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}